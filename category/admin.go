@@ -0,0 +1,249 @@
+// admin.go
+package category
+
+import (
+	"database/sql"
+	"html/template"
+	"lions/database"
+	"lions/session"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// validSlug matches slugs made of lower-case letters, digits and single dashes.
+var validSlug = regexp.MustCompile(`^[\p{Ll}\p{Nd}]+(-[\p{Ll}\p{Nd}]+)*$`)
+
+// AdminPageData holds data for rendering the category administration page.
+type AdminPageData struct {
+	Authenticated bool
+	Username      string
+	Categories    []Category
+	PostCounts    map[int]int // Number of posts per category ID
+	Error         string
+}
+
+// AdminHandler shows the category administration page.
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	renderAdmin(w, r, "")
+}
+
+// SaveHandler creates a new category, or updates an existing one when a
+// category ID is given.
+func SaveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("category_id"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	description := strings.TrimSpace(r.FormValue("description"))
+	slug := strings.TrimSpace(r.FormValue("slug"))
+	icon := strings.TrimSpace(r.FormValue("icon"))
+	sortOrder, _ := strconv.Atoi(r.FormValue("sort_order"))
+	archived := r.FormValue("archived") == "on"
+
+	if name == "" {
+		renderAdmin(w, r, "Category name is required")
+		return
+	}
+	if slug == "" {
+		slug = Slugify(name)
+	}
+	if !validSlug.MatchString(slug) {
+		renderAdmin(w, r, "Slug may only contain lower-case letters, digits and dashes")
+		return
+	}
+
+	// Names and slugs have to stay unique
+	var taken bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM Category WHERE (CategoryName = ? OR Slug = ?) AND CategoryID != ?)`,
+		name, slug, id).Scan(&taken)
+	if err != nil {
+		log.Printf("Error checking category %q: %v", name, err)
+		http.Error(w, "Could not save category", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		renderAdmin(w, r, "Another category already uses that name or slug")
+		return
+	}
+
+	if id == 0 {
+		_, err = database.DB.Exec(`INSERT INTO Category (CategoryName, Description, Slug, SortOrder, Icon, Archived) VALUES (?, ?, ?, ?, ?, ?)`,
+			name, description, slug, sortOrder, icon, archived)
+	} else {
+		_, err = database.DB.Exec(`UPDATE Category SET CategoryName = ?, Description = ?, Slug = ?, SortOrder = ?, Icon = ?, Archived = ? WHERE CategoryID = ?`,
+			name, description, slug, sortOrder, icon, archived, id)
+	}
+	if err != nil {
+		log.Printf("Error saving category %q: %v", name, err)
+		http.Error(w, "Could not save category", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Category saved: %s (%s)", name, slug)
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// MergeHandler moves every post of one category into another and deletes the
+// emptied category.
+func MergeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	sourceID, err1 := strconv.Atoi(r.FormValue("source_id"))
+	targetID, err2 := strconv.Atoi(r.FormValue("target_id"))
+	if err1 != nil || err2 != nil {
+		renderAdmin(w, r, "Choose the category to merge and the category to merge it into")
+		return
+	}
+	if sourceID == targetID {
+		renderAdmin(w, r, "A category cannot be merged into itself")
+		return
+	}
+
+	err := mergeCategories(sourceID, targetID)
+	if err == sql.ErrNoRows {
+		renderAdmin(w, r, "Category not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error merging category %d into %d: %v", sourceID, targetID, err)
+		http.Error(w, "Could not merge categories", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Category %d merged into %d", sourceID, targetID)
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// mergeCategories re-assigns the posts of the source category to the target
+// category and deletes the source category.
+func mergeCategories(sourceID, targetID int) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// Both categories have to exist
+	for _, id := range []int{sourceID, targetID} {
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM Category WHERE CategoryID = ?)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			err = sql.ErrNoRows
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE Post SET CategoryID = ? WHERE CategoryID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Watchers of the source category now watch the target category
+	_, err = tx.Exec(`
+        INSERT OR IGNORE INTO CategoryWatch (UserID, CategoryID, LastVisitedAt, CreatedAt)
+        SELECT UserID, ?, LastVisitedAt, CreatedAt FROM CategoryWatch WHERE CategoryID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM CategoryWatch WHERE CategoryID = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Category WHERE CategoryID = ?`, sourceID)
+	return err
+}
+
+// renderAdmin renders the category administration page with an optional error message.
+func renderAdmin(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	categories, err := List(true)
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		http.Error(w, "Could not fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	postCounts := map[int]int{}
+	rows, err := database.DB.Query(`SELECT CategoryID, COUNT(*) FROM Post GROUP BY CategoryID`)
+	if err != nil {
+		log.Printf("Error counting posts per category: %v", err)
+		http.Error(w, "Could not fetch categories", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err == nil {
+			postCounts[id] = count
+		}
+	}
+
+	data := AdminPageData{
+		Authenticated: true,
+		Username:      r.Context().Value(session.Username).(string),
+		Categories:    categories,
+		PostCounts:    postCounts,
+		Error:         errorMessage,
+	}
+
+	tmpl, err := template.ParseFiles("static/html/admin_categories.html")
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// requireAdmin writes an error response and returns false unless the request
+// comes from a logged in admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return false
+	}
+
+	userID, _ := r.Context().Value(session.UserID).(int)
+	isAdmin, err := database.IsAdmin(userID)
+	if err != nil {
+		log.Printf("Error checking admin role for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !isAdmin {
+		http.Error(w, "Forbidden: Admins only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+// category.go
+package category
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// Category represents a forum category managed by the admins.
+type Category struct {
+	ID          int
+	Name        string
+	Description string
+	Slug        string // URL-friendly name, unique across categories
+	SortOrder   int    // Categories are listed in ascending sort order
+	Icon        string // Font Awesome icon class, e.g. "fa-dragon"
+	Archived    bool   // Archived categories keep their posts but accept no new ones
+}
+
+// Init fills in slugs for categories created before slugs existed and makes
+// sure slugs stay unique.
+func Init() {
+	rows, err := database.DB.Query(`SELECT CategoryID, CategoryName FROM Category WHERE Slug IS NULL OR Slug = ''`)
+	if err != nil {
+		log.Fatalf("Failed to read categories without slugs: %v", err)
+	}
+
+	missing := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			log.Fatalf("Failed to read category: %v", err)
+		}
+		missing[id] = name
+	}
+	rows.Close()
+
+	for id, name := range missing {
+		slug, err := uniqueSlug(Slugify(name), id)
+		if err != nil {
+			log.Fatalf("Failed to create slug for category %q: %v", name, err)
+		}
+		if _, err := database.DB.Exec(`UPDATE Category SET Slug = ? WHERE CategoryID = ?`, slug, id); err != nil {
+			log.Fatalf("Failed to save slug for category %q: %v", name, err)
+		}
+	}
+
+	_, err = database.DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_category_slug ON Category(Slug)`)
+	if err != nil {
+		log.Fatalf("Failed to create category slug index: %v", err)
+	}
+}
+
+// List returns the categories in display order. Archived categories are only
+// included when includeArchived is true.
+func List(includeArchived bool) ([]Category, error) {
+	query := `SELECT CategoryID, CategoryName, Description, Slug, SortOrder, Icon, Archived FROM Category`
+	if !includeArchived {
+		query += ` WHERE Archived = 0`
+	}
+	query += ` ORDER BY SortOrder, CategoryName`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Slug, &c.SortOrder, &c.Icon, &c.Archived); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// GetByName returns the category with the given name.
+func GetByName(name string) (Category, error) {
+	return getOne(`WHERE CategoryName = ?`, name)
+}
+
+// GetByID returns the category with the given ID.
+func GetByID(id int) (Category, error) {
+	return getOne(`WHERE CategoryID = ?`, id)
+}
+
+// GetBySlug returns the category with the given slug.
+func GetBySlug(slug string) (Category, error) {
+	return getOne(`WHERE Slug = ?`, slug)
+}
+
+// getOne returns the single category matching the given WHERE clause.
+func getOne(where string, args ...interface{}) (Category, error) {
+	var c Category
+	err := database.DB.QueryRow(`SELECT CategoryID, CategoryName, Description, Slug, SortOrder, Icon, Archived FROM Category `+where, args...).
+		Scan(&c.ID, &c.Name, &c.Description, &c.Slug, &c.SortOrder, &c.Icon, &c.Archived)
+	return c, err
+}
+
+// Slugify turns a category name into a lower-case, dash-separated slug.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// uniqueSlug returns slug, or slug with a numeric suffix, such that no category
+// other than categoryID uses it.
+func uniqueSlug(slug string, categoryID int) (string, error) {
+	if slug == "" {
+		slug = "category"
+	}
+	candidate := slug
+	for i := 2; ; i++ {
+		var existingID int
+		err := database.DB.QueryRow(`SELECT CategoryID FROM Category WHERE Slug = ?`, candidate).Scan(&existingID)
+		if err == sql.ErrNoRows || (err == nil && existingID == categoryID) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+}
@@ -3,6 +3,8 @@ package comment
 import (
 	"database/sql"
 	"lions/database"
+	"lions/notification"
+	"lions/reputation"
 	"lions/session"
 	"log"
 	"net/http"
@@ -35,22 +37,51 @@ func CommentLikeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked and archived threads don't accept new likes
+	var postID string
+	err = database.DB.QueryRow("SELECT PostID FROM Comment WHERE CommentID = ?", commentIDStr).Scan(&postID)
+	if err == nil {
+		err = database.CheckPostOpen(postID)
+	}
+	if err == database.ErrPostClosed {
+		http.Error(w, "This thread is locked and no longer accepts likes", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
 	// Call function to handle the like/dislike action
-	err = handleCommentLikeDislike(userID, commentIDStr, isLike)
+	liked, err := handleCommentLikeDislike(userID, commentIDStr, isLike)
 	if err != nil {
 		http.Error(w, "Error processing like/dislike", http.StatusInternalServerError)
 		return
 	}
 
+	// The vote counts towards the author's reputation, and the author hears
+	// about new likes
+	var authorID sql.NullInt64
+	if err := database.DB.QueryRow("SELECT UserID FROM Comment WHERE CommentID = ?", commentIDStr).Scan(&authorID); err == nil {
+		if err := reputation.Update(int(authorID.Int64)); err != nil {
+			log.Printf("Error updating reputation of user %d: %v", authorID.Int64, err)
+		}
+		if liked {
+			notification.SendLike(int(authorID.Int64), userID, postID, commentIDStr)
+		}
+	}
+
 	// Redirect back to the post view to show updated like/dislike count
 	http.Redirect(w, r, "/post/view?id="+r.FormValue("post_id"), http.StatusSeeOther)
 }
 
-func handleCommentLikeDislike(userID int, commentIDStr string, isLike bool) error {
+// handleCommentLikeDislike records the user's like or dislike of a comment and
+// reports whether it added a like.
+func handleCommentLikeDislike(userID int, commentIDStr string, isLike bool) (liked bool, err error) {
 	tx, err := database.DB.Begin()
 	if err != nil {
 		log.Printf("Failed to begin transaction: %v", err)
-		return err
+		return false, err
 	}
 	defer func() {
 		if err != nil {
@@ -64,7 +95,7 @@ func handleCommentLikeDislike(userID int, commentIDStr string, isLike bool) erro
 	existingAction, err := getUserCommentAction(userID, commentIDStr)
 	if err != nil && err != sql.ErrNoRows {
 		log.Printf("Error retrieving user action: %v", err)
-		return err
+		return false, err
 	}
 
 	// Handle new action or change of action
@@ -73,38 +104,40 @@ func handleCommentLikeDislike(userID int, commentIDStr string, isLike bool) erro
 		err = insertCommentLikeDislikeTx(tx, userID, commentIDStr, isLike)
 		if err != nil {
 			log.Printf("Error inserting like/dislike: %v", err)
-			return err
+			return false, err
 		}
 		// Update comment counters (increment)
 		err = updateCommentCountersTx(tx, commentIDStr, isLike, true)
+		return err == nil && isLike, err
 	} else {
 		// User is switching from like to dislike or vice versa
 		if (existingAction == "like" && !isLike) || (existingAction == "dislike" && isLike) {
 			err = updateCommentLikeDislikeTx(tx, userID, commentIDStr, isLike)
 			if err != nil {
 				log.Printf("Error updating like/dislike: %v", err)
-				return err
+				return false, err
 			}
 			// Update comment counters accordingly
 			err = updateCommentCountersTx(tx, commentIDStr, isLike, true) // Increment the new action
 			if err != nil {
 				log.Printf("Error incrementing comment counter: %v", err)
-				return err
+				return false, err
 			}
 			err = updateCommentCountersTx(tx, commentIDStr, !isLike, false) // Decrement the old action
+			return err == nil && isLike, err
 		}
 	}
 
-	return err
+	return false, err
 }
 
 func insertCommentLikeDislikeTx(tx *sql.Tx, userID int, commentID string, isLike bool) error {
-	_, err := tx.Exec("INSERT INTO CommentLikes (UserID, CommentID, IsLike) VALUES (?, ?, ?)", userID, commentID, isLike)
+	_, err := tx.Exec("INSERT INTO CommentLikes (UserID, CommentID, IsLike, CreatedAt) VALUES (?, ?, ?, CURRENT_TIMESTAMP)", userID, commentID, isLike)
 	return err
 }
 
 func updateCommentLikeDislikeTx(tx *sql.Tx, userID int, commentID string, isLike bool) error {
-	_, err := tx.Exec("UPDATE CommentLikes SET IsLike = ? WHERE UserID = ? AND CommentID = ?", isLike, userID, commentID)
+	_, err := tx.Exec("UPDATE CommentLikes SET IsLike = ?, CreatedAt = CURRENT_TIMESTAMP WHERE UserID = ? AND CommentID = ?", isLike, userID, commentID)
 	return err
 }
 
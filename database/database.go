@@ -4,9 +4,11 @@ package database
 import (
 	"bufio"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -16,6 +18,9 @@ var (
 	Sessions = make(map[string]string) // Session ID to User ID mapping
 )
 
+// ErrPostClosed is returned when a post is locked or archived and no longer accepts changes.
+var ErrPostClosed = errors.New("post is locked or archived")
+
 // Init initializes the database connection and sets up the schema
 func Init() {
 	var err error
@@ -53,6 +58,11 @@ func Init() {
 		log.Fatalf("Failed to execute schema: %v", err)
 	}
 
+	// Add columns introduced after the database was first created
+	if err := migrate(); err != nil {
+		log.Fatalf("Failed to migrate schema: %v", err)
+	}
+
 	// Log a message indicating the schema setup was successful or already exists
 	log.Println("Database schema and indexes created or already exist.")
 }
@@ -80,7 +90,7 @@ func InsertUser(username, email, password string) error {
 	}
 
 	// Insert the new user into the User table
-	_, err = DB.Exec("INSERT INTO User (Username, Email, Password) VALUES (?, ?, ?)", username, email, password)
+	_, err = DB.Exec("INSERT INTO User (Username, Email, Password, CreatedAt) VALUES (?, ?, ?, ?)", username, email, password, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to insert user: %w", err)
 	}
@@ -88,16 +98,22 @@ func InsertUser(username, email, password string) error {
 	return nil
 }
 
-// GetUserStats retrieves the number of posts, comments, likes, and dislikes for a given user
+// GetUserStats retrieves the number of posts, comments, likes, and dislikes for a given user.
+// Scheduled posts and comments on them are not counted until the post is published.
 func GetUserStats(userID int) (numPosts, numComments, likes, dislikes int, err error) {
-	// Count the number of posts for the specified user
-	err = DB.QueryRow(`SELECT COUNT(*) FROM Post WHERE UserID = ?`, userID).Scan(&numPosts)
+	// Count the number of published posts for the specified user
+	err = DB.QueryRow(`SELECT COUNT(*) FROM Post WHERE UserID = ? AND PublishAt IS NULL`, userID).Scan(&numPosts)
 	if err != nil {
 		return 0, 0, 0, 0, err
 	}
 
-	// Count the number of comments for the specified user
-	err = DB.QueryRow(`SELECT COUNT(*) FROM Comment WHERE UserID = ?`, userID).Scan(&numComments)
+	// Count the number of comments for the specified user on published posts
+	err = DB.QueryRow(`
+        SELECT COUNT(*)
+        FROM Comment c
+        JOIN Post p ON c.PostID = p.PostID
+        WHERE c.UserID = ? AND p.PublishAt IS NULL
+    `, userID).Scan(&numComments)
 	if err != nil {
 		return 0, 0, 0, 0, err
 	}
@@ -125,6 +141,42 @@ func GetUserStats(userID int) (numPosts, numComments, likes, dislikes int, err e
 	return numPosts, numComments, likes, dislikes, nil
 }
 
+// IsModerator reports whether the user has the moderator or admin role
+func IsModerator(userID int) (bool, error) {
+	role, err := userRole(userID)
+	return role == "moderator" || role == "admin", err
+}
+
+// IsAdmin reports whether the user has the admin role
+func IsAdmin(userID int) (bool, error) {
+	role, err := userRole(userID)
+	return role == "admin", err
+}
+
+// userRole returns the role of the user, or an empty string if the user doesn't exist
+func userRole(userID int) (string, error) {
+	var role string
+	err := DB.QueryRow(`SELECT Role FROM User WHERE UserID = ?`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// CheckPostOpen returns ErrPostClosed if the post is locked or archived, and
+// sql.ErrNoRows if it doesn't exist or hasn't been published yet
+func CheckPostOpen(postID string) error {
+	var locked, archived bool
+	err := DB.QueryRow(`SELECT Locked, Archived FROM Post WHERE PostID = ? AND PublishAt IS NULL`, postID).Scan(&locked, &archived)
+	if err != nil {
+		return err
+	}
+	if locked || archived {
+		return ErrPostClosed
+	}
+	return nil
+}
+
 // GetDB returns the database connection pool.
 func GetDB() *sql.DB {
 	return DB
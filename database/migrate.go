@@ -0,0 +1,96 @@
+// migrate.go
+package database
+
+import (
+	"fmt"
+	"log"
+)
+
+// columnMigration describes a column that was added to a table after the table
+// was first released. schema.sql only creates tables that are missing, so
+// databases created by an earlier version need these columns added explicitly.
+type columnMigration struct {
+	Table      string // Table the column belongs to
+	Column     string // Name of the new column
+	Definition string // Column type and constraints used in ALTER TABLE
+}
+
+// columnMigrations lists every column added after the initial schema, in the
+// order they were introduced.
+var columnMigrations = []columnMigration{
+	{"User", "CreatedAt", "DATETIME"},
+	{"User", "Role", "TEXT NOT NULL DEFAULT 'member'"},
+	{"Post", "Pinned", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"Post", "Locked", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"Post", "Archived", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"Category", "Description", "TEXT NOT NULL DEFAULT ''"},
+	{"Category", "Slug", "TEXT"},
+	{"Category", "SortOrder", "INTEGER NOT NULL DEFAULT 0"},
+	{"Category", "Icon", "TEXT NOT NULL DEFAULT ''"},
+	{"Category", "Archived", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"User", "UnsubscribeToken", "TEXT"},
+	{"Comment", "ParentCommentID", "INTEGER REFERENCES Comment(CommentID)"},
+	{"Post", "Book", "TEXT NOT NULL DEFAULT ''"},
+	{"Post", "SpoilerChapter", "INTEGER NOT NULL DEFAULT 0"},
+	{"Comment", "QuotedCommentID", "INTEGER"},
+	{"Comment", "UpdatedAt", "DATETIME"},
+	{"Post", "PublishAt", "DATETIME"},
+	{"PostImage", "ThumbnailPath", "TEXT"},
+	{"PostImage", "ContentType", "TEXT"},
+	{"PostImage", "Position", "INTEGER NOT NULL DEFAULT 0"},
+	{"User", "Bio", "TEXT NOT NULL DEFAULT ''"},
+	{"User", "FavouriteGenres", "TEXT NOT NULL DEFAULT ''"},
+	{"User", "AvatarPath", "TEXT"},
+	{"User", "Reputation", "INTEGER NOT NULL DEFAULT 0"},
+	{"PostLikes", "CreatedAt", "DATETIME"},
+	{"CommentLikes", "CreatedAt", "DATETIME"},
+}
+
+// migrate adds any columns from columnMigrations that are missing from the database.
+func migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(m.Table, m.Column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s.%s: %w", m.Table, m.Column, err)
+		}
+		if exists {
+			continue
+		}
+
+		_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition))
+		if err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.Table, m.Column, err)
+		}
+		log.Printf("Added column %s.%s", m.Table, m.Column)
+	}
+
+	return nil
+}
+
+// columnExists reports whether the given table has a column with the given name.
+func columnExists(table, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal interface{}
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
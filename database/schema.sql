@@ -3,19 +3,22 @@
 -- Create the Category table if it doesn't exist
 CREATE TABLE IF NOT EXISTS Category (
     CategoryID INTEGER PRIMARY KEY AUTOINCREMENT,
-    CategoryName TEXT NOT NULL UNIQUE
+    CategoryName TEXT NOT NULL UNIQUE,
+    Description TEXT NOT NULL DEFAULT '', -- Short description shown in category lists
+    Slug TEXT, -- URL-friendly name, filled in from the name at startup when missing
+    SortOrder INTEGER NOT NULL DEFAULT 0, -- Categories are listed in ascending sort order
+    Icon TEXT NOT NULL DEFAULT '', -- Font Awesome icon class
+    Archived BOOLEAN NOT NULL DEFAULT 0 -- Archived categories accept no new posts
 );
 
--- Insert categories if they do not already exist
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Adventure');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Historical');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Sci-Fi');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('General');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Thriller');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Fantasy');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Science Fiction');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Romance');
-INSERT OR IGNORE INTO Category (CategoryName) VALUES ('Mystery');
+-- Seed the initial categories when the database is created; after that they are managed on /admin/categories
+INSERT INTO Category (CategoryName)
+SELECT Name FROM (
+    SELECT 'General' AS Name UNION ALL SELECT 'Adventure' UNION ALL SELECT 'Fantasy'
+    UNION ALL SELECT 'Historical' UNION ALL SELECT 'Mystery' UNION ALL SELECT 'Romance'
+    UNION ALL SELECT 'Science Fiction' UNION ALL SELECT 'Thriller'
+)
+WHERE NOT EXISTS (SELECT 1 FROM Category);
 
 
 
@@ -24,7 +27,14 @@ CREATE TABLE IF NOT EXISTS User (
     UserID INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique identifier for each user
     Email TEXT UNIQUE NOT NULL, -- User's email address, must be unique
     Username TEXT UNIQUE NOT NULL, -- User's username, must be unique
-    Password TEXT NOT NULL -- User's hashed password
+    Password TEXT NOT NULL, -- User's hashed password
+    CreatedAt DATETIME, -- Timestamp when the user registered
+    Role TEXT NOT NULL DEFAULT 'member', -- 'member', 'moderator' or 'admin'
+    UnsubscribeToken TEXT, -- Secret token used in email unsubscribe links
+    Bio TEXT NOT NULL DEFAULT '', -- What the user tells about themselves on their profile
+    FavouriteGenres TEXT NOT NULL DEFAULT '', -- Comma-separated names of the user's favourite categories
+    AvatarPath TEXT, -- Path to the user's profile picture, NULL for the default one
+    Reputation INTEGER NOT NULL DEFAULT 0 -- Score from the votes on the user's posts and replies, kept up to date by the reputation package
 );
 
 -- Post Table
@@ -39,6 +49,12 @@ CREATE TABLE IF NOT EXISTS Post (
     CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the post was created
     LikesCount INTEGER DEFAULT 0,
     DislikesCount INTEGER DEFAULT 0,
+    Pinned BOOLEAN NOT NULL DEFAULT 0, -- Pinned posts are listed before all others
+    Locked BOOLEAN NOT NULL DEFAULT 0, -- Locked posts accept no new replies or likes
+    Archived BOOLEAN NOT NULL DEFAULT 0, -- Archived posts are read-only like locked ones
+    Book TEXT NOT NULL DEFAULT '', -- Book the post discusses, empty when it isn't about one book
+    SpoilerChapter INTEGER NOT NULL DEFAULT 0, -- Last chapter of Book the post spoils, 0 for none
+    PublishAt DATETIME, -- When a scheduled post goes live, NULL once it is published
     FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE SET NULL, -- Foreign key to User table
     FOREIGN KEY (CategoryID) REFERENCES Category(CategoryID), -- Foreign key to Category table
     FOREIGN KEY (LastReplyUser) REFERENCES User(UserID) -- Foreign key to User table for LastReplyUser
@@ -49,6 +65,9 @@ CREATE TABLE IF NOT EXISTS PostImage (
     PostID INTEGER, -- Foreign key referencing the Post table
     UserID INTEGER, -- ID of the user who uploaded the image
     ImagePath TEXT, -- Path or URL to the image file
+    ThumbnailPath TEXT, -- Path or URL to the scaled-down copy of the image
+    ContentType TEXT, -- MIME type sniffed from the file contents
+    Position INTEGER NOT NULL DEFAULT 0, -- Order of the image in the post
     CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the image was uploaded
     FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE CASCADE, -- Foreign key to Post table
     FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE SET NULL -- Foreign key to User table
@@ -65,14 +84,19 @@ CREATE TABLE IF NOT EXISTS Comment (
     CommentDislikesCount INTEGER DEFAULT 0,
     TaggedUser VARCHAR(255),
     CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the comment was created
+    ParentCommentID INTEGER, -- ID of the comment this is a reply to, NULL for replies to the post
+    QuotedCommentID INTEGER, -- ID of the comment this one quotes, NULL when it quotes none
+    UpdatedAt DATETIME, -- When the comment was last edited, NULL if it never was
     FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE CASCADE, -- Foreign key to Post table
-    FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE SET NULL -- Foreign key to User table
+    FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE SET NULL, -- Foreign key to User table
+    FOREIGN KEY (ParentCommentID) REFERENCES Comment(CommentID) -- Foreign key to the parent comment
 );
 
 CREATE TABLE IF NOT EXISTS PostLikes (
     UserID INTEGER, -- ID of the user who liked/disliked
     PostID INTEGER, -- ID of the post being liked/disliked
     IsLike BOOLEAN, -- True for like, False for dislike
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- When the vote was cast or last changed
     PRIMARY KEY (UserID, PostID), -- Composite primary key: each user can like/dislike a post only once
     FOREIGN KEY (UserID) REFERENCES User(UserID),
     FOREIGN KEY (PostID) REFERENCES Post(PostID)
@@ -82,11 +106,204 @@ CREATE TABLE IF NOT EXISTS CommentLikes (
     UserID INTEGER, -- ID of the user who liked/disliked
     CommentID INTEGER, -- ID of the comment being liked/disliked
     IsLike BOOLEAN, -- True for like, False for dislike
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- When the vote was cast or last changed
     PRIMARY KEY (UserID, CommentID), -- Composite primary key: each user can like/dislike a comment only once
     FOREIGN KEY (UserID) REFERENCES User(UserID),
     FOREIGN KEY (CommentID) REFERENCES Comment(CommentID)
 );
 
+-- Table to store @mentions of users in posts and comments
+CREATE TABLE IF NOT EXISTS Mention (
+    MentionID INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique identifier for each mention
+    UserID INTEGER NOT NULL, -- ID of the mentioned user
+    AuthorID INTEGER, -- ID of the user who wrote the mention
+    PostID INTEGER NOT NULL, -- ID of the post containing the mention
+    CommentID INTEGER, -- ID of the comment containing the mention, NULL when it is in the post itself
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the mention was made
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (AuthorID) REFERENCES User(UserID) ON DELETE SET NULL,
+    FOREIGN KEY (PostID) REFERENCES Post(PostID),
+    FOREIGN KEY (CommentID) REFERENCES Comment(CommentID)
+);
+
+-- Table to store notifications shown in a user's notification center
+CREATE TABLE IF NOT EXISTS Notification (
+    NotificationID INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique identifier for each notification
+    UserID INTEGER NOT NULL, -- ID of the user receiving the notification
+    ActorID INTEGER, -- ID of the user whose action caused the notification
+    Type TEXT NOT NULL, -- reply_post, reply_comment, mention, like, moderation, thread_replies or category_threads
+    PostID INTEGER, -- ID of the post the notification is about
+    CommentID INTEGER, -- ID of the comment the notification is about, NULL for the post itself
+    Detail TEXT NOT NULL DEFAULT '', -- Message for moderation notifications
+    Count INTEGER NOT NULL DEFAULT 1, -- Number of batched actions (likes)
+    IsRead BOOLEAN NOT NULL DEFAULT 0, -- Whether the user has read the notification
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp of the latest action
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (ActorID) REFERENCES User(UserID) ON DELETE SET NULL,
+    FOREIGN KEY (PostID) REFERENCES Post(PostID)
+);
+
+-- Table to store the threads users watch
+CREATE TABLE IF NOT EXISTS PostWatch (
+    UserID INTEGER NOT NULL, -- ID of the watching user
+    PostID INTEGER NOT NULL, -- ID of the watched post
+    LastVisitedAt DATETIME NOT NULL, -- When the user last opened the thread
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the user started watching
+    PRIMARY KEY (UserID, PostID),
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (PostID) REFERENCES Post(PostID)
+);
+
+-- Table to store the categories users watch
+CREATE TABLE IF NOT EXISTS CategoryWatch (
+    UserID INTEGER NOT NULL, -- ID of the watching user
+    CategoryID INTEGER NOT NULL, -- ID of the watched category
+    LastVisitedAt DATETIME NOT NULL, -- When the user last opened the category
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the user started watching
+    PRIMARY KEY (UserID, CategoryID),
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (CategoryID) REFERENCES Category(CategoryID)
+);
+
+-- Table to store how far each user has read each thread
+CREATE TABLE IF NOT EXISTS ReadMarker (
+    UserID INTEGER NOT NULL, -- ID of the reader
+    PostID INTEGER NOT NULL, -- ID of the read post
+    LastReadCommentID INTEGER NOT NULL DEFAULT 0, -- ID of the newest comment the user has seen, 0 for none
+    ReadAt DATETIME NOT NULL, -- When the user last read the thread
+    PRIMARY KEY (UserID, PostID),
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (PostID) REFERENCES Post(PostID)
+);
+
+-- Table to store how far each user has read each book
+CREATE TABLE IF NOT EXISTS ReadingProgress (
+    UserID INTEGER NOT NULL, -- ID of the reader
+    Book TEXT NOT NULL, -- Book title, lower-cased with single spaces
+    Chapter INTEGER NOT NULL DEFAULT 0, -- Last chapter the user has read
+    UpdatedAt DATETIME NOT NULL, -- When the user last updated their progress
+    PRIMARY KEY (UserID, Book),
+    FOREIGN KEY (UserID) REFERENCES User(UserID)
+);
+
+-- Table to store unsent posts and replies, autosaved while they are written
+CREATE TABLE IF NOT EXISTS Draft (
+    DraftID INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique identifier for each draft
+    UserID INTEGER NOT NULL, -- ID of the writer
+    PostID INTEGER NOT NULL DEFAULT 0, -- ID of the post a draft reply is for, 0 for a new post
+    Title TEXT NOT NULL DEFAULT '', -- Title of a new post
+    Content TEXT NOT NULL DEFAULT '', -- Text written so far
+    CategoryName TEXT NOT NULL DEFAULT '', -- Category chosen for a new post
+    Tags TEXT NOT NULL DEFAULT '', -- Comma-separated tags of a new post, as typed
+    Book TEXT NOT NULL DEFAULT '', -- Book a new post is about
+    SpoilerChapter TEXT NOT NULL DEFAULT '', -- Spoiler chapter of a new post, as typed
+    UpdatedAt DATETIME NOT NULL, -- When the draft was last saved
+    FOREIGN KEY (UserID) REFERENCES User(UserID)
+);
+
+-- Table to store images attached to replies
+CREATE TABLE IF NOT EXISTS CommentImage (
+    ID TEXT PRIMARY KEY, -- Unique identifier for each image
+    CommentID INTEGER NOT NULL, -- ID of the reply the image belongs to
+    PostID INTEGER NOT NULL, -- ID of the post the reply belongs to
+    UserID INTEGER, -- ID of the user who uploaded the image
+    ImagePath TEXT NOT NULL, -- Path or URL to the image file
+    ThumbnailPath TEXT NOT NULL, -- Path or URL to the scaled-down copy of the image
+    ContentType TEXT NOT NULL, -- MIME type sniffed from the file contents
+    Position INTEGER NOT NULL DEFAULT 0, -- Order of the image in the reply
+    CreatedAt DATETIME NOT NULL, -- When the image was uploaded
+    FOREIGN KEY (CommentID) REFERENCES Comment(CommentID),
+    FOREIGN KEY (PostID) REFERENCES Post(PostID),
+    FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE SET NULL
+);
+
+-- Table to store the polls attached to posts
+CREATE TABLE IF NOT EXISTS Poll (
+    PostID INTEGER PRIMARY KEY, -- ID of the post the poll belongs to, a post has at most one poll
+    Question TEXT NOT NULL, -- Question asked
+    MultipleChoice BOOLEAN NOT NULL DEFAULT 0, -- Voters may pick more than one option
+    Anonymous BOOLEAN NOT NULL DEFAULT 0, -- Who voted for what is never shown
+    ResultsAfterClose BOOLEAN NOT NULL DEFAULT 0, -- Results are hidden until the poll closes instead of until the user votes
+    ClosesAt DATETIME, -- When voting ends, NULL to keep the poll open
+    CreatedAt DATETIME NOT NULL, -- When the poll was created
+    FOREIGN KEY (PostID) REFERENCES Post(PostID)
+);
+
+-- Table to store the options of each poll
+CREATE TABLE IF NOT EXISTS PollOption (
+    OptionID INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique identifier for each option
+    PostID INTEGER NOT NULL, -- ID of the post whose poll the option belongs to
+    Text TEXT NOT NULL, -- Text of the option
+    Position INTEGER NOT NULL DEFAULT 0, -- Order of the option in the poll
+    FOREIGN KEY (PostID) REFERENCES Poll(PostID)
+);
+
+-- Table to store poll votes
+CREATE TABLE IF NOT EXISTS PollVote (
+    UserID INTEGER NOT NULL, -- ID of the voter
+    PostID INTEGER NOT NULL, -- ID of the post whose poll was voted in
+    OptionID INTEGER NOT NULL, -- ID of the chosen option
+    CreatedAt DATETIME NOT NULL, -- When the vote was cast
+    PRIMARY KEY (UserID, OptionID), -- Composite primary key: each user can vote for an option only once
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (OptionID) REFERENCES PollOption(OptionID)
+);
+
+-- Table to store one ballot per user and poll, so nobody can vote twice
+CREATE TABLE IF NOT EXISTS PollBallot (
+    UserID INTEGER NOT NULL, -- ID of the voter
+    PostID INTEGER NOT NULL, -- ID of the post whose poll was voted in
+    CreatedAt DATETIME NOT NULL, -- When the vote was cast
+    PRIMARY KEY (UserID, PostID), -- Composite primary key: each user can vote in a poll only once
+    FOREIGN KEY (UserID) REFERENCES User(UserID),
+    FOREIGN KEY (PostID) REFERENCES Post(PostID)
+);
+
+-- Give votes cast before ballots were recorded a ballot
+INSERT OR IGNORE INTO PollBallot (UserID, PostID, CreatedAt)
+SELECT UserID, PostID, MIN(CreatedAt) FROM PollVote GROUP BY UserID, PostID;
+
+-- Table to store how often users want emails about each kind of activity
+CREATE TABLE IF NOT EXISTS EmailPreference (
+    UserID INTEGER NOT NULL, -- ID of the user
+    Type TEXT NOT NULL, -- Kind of activity, e.g. reply_post or thread_replies
+    Frequency TEXT NOT NULL, -- immediate, daily, weekly or off
+    PRIMARY KEY (UserID, Type),
+    FOREIGN KEY (UserID) REFERENCES User(UserID)
+);
+
+-- Table to store when each user last got a daily or weekly digest
+CREATE TABLE IF NOT EXISTS EmailDigest (
+    UserID INTEGER NOT NULL, -- ID of the user
+    Frequency TEXT NOT NULL, -- daily or weekly
+    LastSentAt DATETIME NOT NULL, -- Activity up to this time has been included in a digest
+    PRIMARY KEY (UserID, Frequency),
+    FOREIGN KEY (UserID) REFERENCES User(UserID)
+);
+
+-- Table to store free-form tags
+CREATE TABLE IF NOT EXISTS Tag (
+    TagID INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique identifier for each tag
+    Name TEXT NOT NULL UNIQUE -- Normalized tag name, lower case with dashes
+);
+
+-- Table linking posts to their tags
+CREATE TABLE IF NOT EXISTS PostTag (
+    PostID INTEGER, -- ID of the tagged post
+    TagID INTEGER, -- ID of the tag
+    PRIMARY KEY (PostID, TagID), -- Each tag can be added to a post only once
+    FOREIGN KEY (PostID) REFERENCES Post(PostID),
+    FOREIGN KEY (TagID) REFERENCES Tag(TagID)
+);
+
+-- Table to store where merged posts now live, so old links keep working
+CREATE TABLE IF NOT EXISTS PostRedirect (
+    OldPostID INTEGER PRIMARY KEY, -- ID of the post that was merged away
+    NewPostID INTEGER NOT NULL, -- ID of the post it was merged into
+    CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp when the posts were merged
+    FOREIGN KEY (NewPostID) REFERENCES Post(PostID)
+);
+
 -- Table to store password reset tokens
 CREATE TABLE IF NOT EXISTS PasswordReset (
     Email TEXT NOT NULL, -- Email of the user requesting a password reset
@@ -111,3 +328,14 @@ CREATE INDEX IF NOT EXISTS idx_like_user ON PostLikes(UserID); -- Index on UserI
 CREATE INDEX IF NOT EXISTS idx_like_post ON PostLikes(PostID); -- Index on PostID in PostLikes table
 CREATE INDEX IF NOT EXISTS idx_like_comment ON CommentLikes(CommentID); -- Index on CommentID in CommentLikes table
 CREATE INDEX IF NOT EXISTS idx_post_last_reply ON Post(LastReplyDate); -- Index on LastReplyDate in Post table
+CREATE INDEX IF NOT EXISTS idx_post_tag_tag ON PostTag(TagID); -- Index on TagID in PostTag table
+CREATE INDEX IF NOT EXISTS idx_mention_user ON Mention(UserID); -- Index on UserID in Mention table
+CREATE INDEX IF NOT EXISTS idx_mention_post ON Mention(PostID); -- Index on PostID in Mention table
+CREATE INDEX IF NOT EXISTS idx_post_watch_post ON PostWatch(PostID); -- Index on PostID in PostWatch table
+CREATE INDEX IF NOT EXISTS idx_category_watch_category ON CategoryWatch(CategoryID); -- Index on CategoryID in CategoryWatch table
+CREATE INDEX IF NOT EXISTS idx_notification_user ON Notification(UserID, IsRead); -- Index on UserID and IsRead in Notification table
+CREATE INDEX IF NOT EXISTS idx_draft_user ON Draft(UserID, PostID); -- Index on UserID and PostID in Draft table
+CREATE INDEX IF NOT EXISTS idx_post_image_post ON PostImage(PostID); -- Index on PostID in PostImage table
+CREATE INDEX IF NOT EXISTS idx_comment_image_post ON CommentImage(PostID, CommentID); -- Index on PostID and CommentID in CommentImage table
+CREATE INDEX IF NOT EXISTS idx_poll_option_post ON PollOption(PostID); -- Index on PostID in PollOption table
+CREATE INDEX IF NOT EXISTS idx_poll_vote_post ON PollVote(PostID, UserID); -- Index on PostID and UserID in PollVote table
@@ -0,0 +1,135 @@
+// digest.go
+package digest
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"lions/email"
+	"lions/env"
+	"lions/notification"
+	"log"
+	"strings"
+	"time"
+)
+
+// periods maps each digest frequency to how often its digest is sent.
+var periods = map[string]time.Duration{
+	email.Daily:  24 * time.Hour,
+	email.Weekly: 7 * 24 * time.Hour,
+}
+
+// CheckInterval is how often the scheduler looks for digests that are due. It
+// can be changed with the DIGEST_CHECK_INTERVAL environment variable.
+var CheckInterval = env.PositiveDuration("DIGEST_CHECK_INTERVAL", time.Hour)
+
+// Start runs the digest scheduler in the background.
+func Start() {
+	go func() {
+		for {
+			run(time.Now())
+			time.Sleep(CheckInterval)
+		}
+	}()
+	log.Printf("Digest scheduler started, checking every %s", CheckInterval)
+}
+
+// run sends every daily and weekly digest that is due at the given time.
+func run(now time.Time) {
+	rows, err := database.DB.Query(`SELECT UserID FROM User`)
+	if err != nil {
+		log.Printf("Error fetching users for digests: %v", err)
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		for frequency, period := range periods {
+			if err := sendIfDue(userID, frequency, period, now); err != nil {
+				log.Printf("Error sending %s digest to user %d: %v", frequency, userID, err)
+			}
+		}
+	}
+}
+
+// sendIfDue compiles and sends a user's digest when its period has passed
+// since the last one.
+func sendIfDue(userID int, frequency string, period time.Duration, now time.Time) error {
+	var lastSent time.Time
+	err := database.DB.QueryRow(`SELECT LastSentAt FROM EmailDigest WHERE UserID = ? AND Frequency = ?`,
+		userID, frequency).Scan(&lastSent)
+	if err == sql.ErrNoRows {
+		// Start counting from now instead of sending everything that ever happened
+		_, err = database.DB.Exec(`INSERT INTO EmailDigest (UserID, Frequency, LastSentAt) VALUES (?, ?, ?)`,
+			userID, frequency, now)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if now.Sub(lastSent) < period {
+		return nil
+	}
+
+	preferences, err := email.Preferences(userID)
+	if err != nil {
+		return err
+	}
+	var types []string
+	for _, t := range email.ActivityTypes {
+		if preferences[t.Key] == frequency {
+			types = append(types, t.Key)
+		}
+	}
+
+	sections, err := compile(userID, types, lastSent)
+	if err != nil {
+		return err
+	}
+
+	if len(sections) > 0 {
+		subject := fmt.Sprintf("Your %s Literary Lions digest", frequency)
+		body := fmt.Sprintf("Here is what happened on the Literary Lions Forum since %s.\n\n%s",
+			lastSent.Format("January 2, 2006"), strings.Join(sections, "\n\n"))
+		email.SendToUser(userID, "", subject, body)
+	}
+
+	_, err = database.DB.Exec(`UPDATE EmailDigest SET LastSentAt = ? WHERE UserID = ? AND Frequency = ?`,
+		now, userID, frequency)
+	return err
+}
+
+// compile returns the sections of a digest covering the given activity types
+// since the given time. Empty sections are left out.
+func compile(userID int, types []string, since time.Time) ([]string, error) {
+	notifications, err := notification.Since(userID, types, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the notifications by activity type, in settings page order
+	byType := map[string][]notification.Notification{}
+	for _, n := range notifications {
+		byType[n.Type] = append(byType[n.Type], n)
+	}
+
+	var sections []string
+	for _, t := range email.ActivityTypes {
+		if len(byType[t.Key]) == 0 {
+			continue
+		}
+		lines := []string{t.Label + ":"}
+		for _, n := range byType[t.Key] {
+			lines = append(lines, "- "+n.Text()+"\n  "+email.SiteURL+n.URL())
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	return sections, nil
+}
@@ -0,0 +1,147 @@
+// draft.go
+package draft
+
+import (
+	"database/sql"
+	"lions/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Draft is an unsent new post or reply, autosaved while the user types.
+type Draft struct {
+	ID             int
+	PostID         int    // Thread the reply is for, 0 for a new post
+	PostTitle      string // Title of that thread
+	Title          string
+	Content        string
+	Category       string
+	Tags           string // Comma-separated, as typed
+	Book           string
+	SpoilerChapter string // As typed, it is only checked when the post is sent
+	UpdatedAt      time.Time
+}
+
+// IsReply reports whether the draft is a reply rather than a new post.
+func (d Draft) IsReply() bool {
+	return d.PostID != 0
+}
+
+// Empty reports whether nothing has been written in the draft yet.
+func (d Draft) Empty() bool {
+	return d.Title == "" && d.Content == ""
+}
+
+// Preview returns the start of the draft's text for the drafts list.
+func (d Draft) Preview() string {
+	runes := []rune(strings.Join(strings.Fields(d.Content), " "))
+	if len(runes) > previewLength {
+		return string(runes[:previewLength]) + "…"
+	}
+	return string(runes)
+}
+
+// previewLength is the number of characters shown by Preview.
+const previewLength = 120
+
+const selectDrafts = `
+        SELECT d.DraftID, d.PostID, COALESCE(p.Title, ''), d.Title, d.Content, d.CategoryName,
+               d.Tags, d.Book, d.SpoilerChapter, d.UpdatedAt
+        FROM Draft d
+        LEFT JOIN Post p ON p.PostID = d.PostID`
+
+func scan(row interface{ Scan(...interface{}) error }) (Draft, error) {
+	var d Draft
+	err := row.Scan(&d.ID, &d.PostID, &d.PostTitle, &d.Title, &d.Content, &d.Category,
+		&d.Tags, &d.Book, &d.SpoilerChapter, &d.UpdatedAt)
+	return d, err
+}
+
+// Get returns the draft draftID of userID, or sql.ErrNoRows when the user has
+// no such draft.
+func Get(userID, draftID int) (Draft, error) {
+	return scan(database.DB.QueryRow(selectDrafts+` WHERE d.DraftID = ? AND d.UserID = ?`, draftID, userID))
+}
+
+// Latest returns the most recently saved new post draft of userID, or
+// sql.ErrNoRows when there is none.
+func Latest(userID int) (Draft, error) {
+	return scan(database.DB.QueryRow(selectDrafts+`
+        WHERE d.UserID = ? AND d.PostID = 0
+        ORDER BY d.UpdatedAt DESC, d.DraftID DESC LIMIT 1`, userID))
+}
+
+// ForPost returns the draft reply of userID in the thread postID, or
+// sql.ErrNoRows when there is none.
+func ForPost(userID int, postID string) (Draft, error) {
+	return scan(database.DB.QueryRow(selectDrafts+`
+        WHERE d.UserID = ? AND d.PostID = ?
+        ORDER BY d.UpdatedAt DESC, d.DraftID DESC LIMIT 1`, userID, postID))
+}
+
+// List returns every draft of userID, most recently saved first.
+func List(userID int) ([]Draft, error) {
+	rows, err := database.DB.Query(selectDrafts+`
+        WHERE d.UserID = ?
+        ORDER BY d.UpdatedAt DESC, d.DraftID DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+	for rows.Next() {
+		d, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// Save stores d for userID and returns its ID. A draft without an ID updates
+// the user's existing draft reply in the same thread, if there is one, so each
+// thread has a single draft reply.
+func Save(userID int, d Draft) (int, error) {
+	if d.ID == 0 && d.IsReply() {
+		existing, err := ForPost(userID, strconv.Itoa(d.PostID))
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		d.ID = existing.ID
+	}
+
+	now := time.Now()
+	if d.ID != 0 {
+		result, err := database.DB.Exec(`
+            UPDATE Draft SET Title = ?, Content = ?, CategoryName = ?, Tags = ?, Book = ?, SpoilerChapter = ?, UpdatedAt = ?
+            WHERE DraftID = ? AND UserID = ? AND PostID = ?`,
+			d.Title, d.Content, d.Category, d.Tags, d.Book, d.SpoilerChapter, now, d.ID, userID, d.PostID)
+		if err != nil {
+			return 0, err
+		}
+		// A draft deleted in the meantime, for example by sending it from
+		// another tab, is saved again as a new one
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			return d.ID, err
+		}
+	}
+
+	result, err := database.DB.Exec(`
+        INSERT INTO Draft (UserID, PostID, Title, Content, CategoryName, Tags, Book, SpoilerChapter, UpdatedAt)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, d.PostID, d.Title, d.Content, d.Category, d.Tags, d.Book, d.SpoilerChapter, now)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// Delete removes the draft draftID of userID.
+func Delete(userID, draftID int) error {
+	_, err := database.DB.Exec(`DELETE FROM Draft WHERE DraftID = ? AND UserID = ?`, draftID, userID)
+	return err
+}
@@ -0,0 +1,168 @@
+// handlers.go
+package draft
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"lions/database"
+	"lions/session"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PageData holds data for rendering the drafts page.
+type PageData struct {
+	Authenticated bool
+	Username      string
+	Drafts        []Draft
+}
+
+// PageHandler lists the drafts of the logged in user.
+func PageHandler(w http.ResponseWriter, r *http.Request) {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	drafts, err := List(userID)
+	if err != nil {
+		log.Printf("Error fetching drafts for user %d: %v", userID, err)
+		http.Error(w, "Could not fetch drafts", http.StatusInternalServerError)
+		return
+	}
+
+	data := PageData{
+		Authenticated: true,
+		Username:      r.Context().Value(session.Username).(string),
+		Drafts:        drafts,
+	}
+
+	tmpl, err := template.ParseFiles("static/html/drafts.html")
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// SaveHandler autosaves a new post or reply form as a draft and answers with
+// the draft's ID as JSON. The form is the one being written, plus draft_id
+// once it has been saved before. Saving a form with no title or content left
+// deletes its draft.
+func SaveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	// Answer with an error instead of the login page, so the form can tell
+	// the user their work is no longer being saved
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	d := Draft{
+		Title:          strings.TrimSpace(r.FormValue("title")),
+		Content:        r.FormValue("content"),
+		Category:       r.FormValue("category"),
+		Tags:           r.FormValue("tags"),
+		Book:           r.FormValue("book"),
+		SpoilerChapter: r.FormValue("spoiler_chapter"),
+	}
+	if id := r.FormValue("draft_id"); id != "" {
+		var err error
+		if d.ID, err = strconv.Atoi(id); err != nil {
+			http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+			return
+		}
+	}
+	if postID := r.FormValue("postID"); postID != "" {
+		err := database.DB.QueryRow(`SELECT PostID FROM Post WHERE PostID = ?`, postID).Scan(&d.PostID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking post %s for draft: %v", postID, err)
+			http.Error(w, "Could not save draft", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if strings.TrimSpace(d.Content) == "" && d.Title == "" {
+		if d.ID != 0 {
+			if err := Delete(userID, d.ID); err != nil {
+				log.Printf("Error deleting draft %d of user %d: %v", d.ID, userID, err)
+				http.Error(w, "Could not save draft", http.StatusInternalServerError)
+				return
+			}
+		}
+		d.ID = 0
+	} else {
+		var err error
+		if d.ID, err = Save(userID, d); err != nil {
+			log.Printf("Error saving draft of user %d: %v", userID, err)
+			http.Error(w, "Could not save draft", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"id": d.ID})
+}
+
+// DeleteHandler discards the draft in draft_id of the logged in user and
+// goes back to where the draft was written, or to the drafts page when return
+// is "drafts".
+func DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	draftID, err := strconv.Atoi(r.FormValue("draft_id"))
+	if err != nil {
+		http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+		return
+	}
+	d, err := Get(userID, draftID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching draft %d: %v", draftID, err)
+		http.Error(w, "Could not discard draft", http.StatusInternalServerError)
+		return
+	}
+	if err := Delete(userID, draftID); err != nil {
+		log.Printf("Error deleting draft %d of user %d: %v", draftID, userID, err)
+		http.Error(w, "Could not discard draft", http.StatusInternalServerError)
+		return
+	}
+
+	target := "/post?draft=new#create-post"
+	switch {
+	case r.FormValue("return") == "drafts":
+		target = "/drafts"
+	case d.IsReply():
+		target = "/post/view?id=" + strconv.Itoa(d.PostID) + "#reply-form"
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
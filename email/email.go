@@ -4,6 +4,7 @@ package email
 import (
 	"fmt"
 	"net/smtp"
+	"strings"
 )
 
 // Email configuration variables
@@ -18,11 +19,21 @@ var (
 // SendEmail sends an email with the given subject and body to the specified recipient.
 // It connects to the SMTP server, authenticates, and sends the email.
 func SendEmail(to, subject, body string) error {
+	return SendEmailWithHeaders(to, subject, body, nil)
+}
+
+// SendEmailWithHeaders sends an email like SendEmail, adding the given extra
+// headers (for example List-Unsubscribe) to the message.
+func SendEmailWithHeaders(to, subject, body string, headers map[string]string) error {
 	// Create the authentication credentials for the SMTP server
 	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
-	
+
 	// Create the email message
-	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s", to, subject, body))
+	var extra strings.Builder
+	for name, value := range headers {
+		extra.WriteString(name + ": " + value + "\r\n")
+	}
+	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n%s\r\n%s", to, subject, extra.String(), body))
 	
 	// Define the server address
 	addr := smtpHost + ":" + smtpPort
@@ -0,0 +1,134 @@
+// handlers.go
+package email
+
+import (
+	"database/sql"
+	"html/template"
+	"lions/database"
+	"lions/session"
+	"log"
+	"net/http"
+)
+
+// SettingsPageData holds data for rendering the email settings page.
+type SettingsPageData struct {
+	Authenticated bool
+	Username      string
+	Email         string
+	Types         []ActivityType
+	Frequencies   []string
+	Preferences   map[string]string // Frequency per activity type
+	Saved         bool
+}
+
+// UnsubscribePageData holds data for rendering the unsubscribe page.
+type UnsubscribePageData struct {
+	Token        string
+	Type         string
+	Label        string // Label of the activity type, empty for all emails
+	Unsubscribed bool
+}
+
+// SettingsHandler shows and saves the logged in user's email preferences.
+func SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	if r.Method == http.MethodPost {
+		for _, t := range ActivityTypes {
+			if err := SetPreference(userID, t.Key, r.FormValue(t.Key)); err != nil {
+				log.Printf("Error saving email preference %s for user %d: %v", t.Key, userID, err)
+				http.Error(w, "Could not save email settings", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, "/settings/email?saved=1", http.StatusSeeOther)
+		return
+	}
+
+	preferences, err := Preferences(userID)
+	if err != nil {
+		log.Printf("Error fetching email preferences for user %d: %v", userID, err)
+		http.Error(w, "Could not fetch email settings", http.StatusInternalServerError)
+		return
+	}
+
+	var address string
+	if err := database.DB.QueryRow(`SELECT Email FROM User WHERE UserID = ?`, userID).Scan(&address); err != nil {
+		log.Printf("Error fetching email address of user %d: %v", userID, err)
+		http.Error(w, "Could not fetch email settings", http.StatusInternalServerError)
+		return
+	}
+
+	data := SettingsPageData{
+		Authenticated: true,
+		Username:      r.Context().Value(session.Username).(string),
+		Email:         address,
+		Types:         ActivityTypes,
+		Frequencies:   Frequencies,
+		Preferences:   preferences,
+		Saved:         r.URL.Query().Get("saved") != "",
+	}
+	render(w, "static/html/email_settings.html", data)
+}
+
+// UnsubscribeHandler turns off emails for the user identified by the token in
+// an unsubscribe link. GET shows a confirmation button so that link scanners
+// don't unsubscribe anyone; POST, also used by one-click unsubscribe in mail
+// clients, applies it.
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	key := r.FormValue("type")
+
+	var userID int
+	err := database.DB.QueryRow(`SELECT UserID FROM User WHERE UnsubscribeToken = ?`, token).Scan(&userID)
+	if token == "" || err == sql.ErrNoRows {
+		http.Error(w, "This unsubscribe link is not valid", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up unsubscribe token: %v", err)
+		http.Error(w, "Could not unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	data := UnsubscribePageData{Token: token}
+	if t, ok := activityType(key); ok {
+		data.Type = t.Key
+		data.Label = t.Label
+	}
+
+	if r.Method == http.MethodPost {
+		for _, t := range ActivityTypes {
+			if data.Type != "" && t.Key != data.Type {
+				continue
+			}
+			if err := SetPreference(userID, t.Key, Off); err != nil {
+				log.Printf("Error unsubscribing user %d from %s: %v", userID, t.Key, err)
+				http.Error(w, "Could not unsubscribe", http.StatusInternalServerError)
+				return
+			}
+		}
+		log.Printf("User %d unsubscribed from %q emails", userID, data.Type)
+		data.Unsubscribed = true
+	}
+
+	render(w, "static/html/unsubscribe.html", data)
+}
+
+// render executes a template file with the given data.
+func render(w http.ResponseWriter, file string, data interface{}) {
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
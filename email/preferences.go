@@ -0,0 +1,200 @@
+// preferences.go
+package email
+
+import (
+	"database/sql"
+	"lions/database"
+	"lions/env"
+	"log"
+	"mime"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// How often a user wants emails about a kind of activity.
+const (
+	Immediate = "immediate" // One email per notification
+	Daily     = "daily"     // Collected in a daily digest
+	Weekly    = "weekly"    // Collected in a weekly digest
+	Off       = "off"       // No emails
+)
+
+// Frequencies lists every frequency in the order shown on the settings page.
+var Frequencies = []string{Immediate, Daily, Weekly, Off}
+
+// Activity types that can be emailed. They match the notification types.
+const (
+	TypeReplyToPost     = "reply_post"
+	TypeReplyToComment  = "reply_comment"
+	TypeMention         = "mention"
+	TypeLike            = "like"
+	TypeModeration      = "moderation"
+	TypeThreadReplies   = "thread_replies"   // New replies in watched threads
+	TypeCategoryThreads = "category_threads" // New threads in watched categories
+)
+
+// ActivityType describes a kind of activity a user can get emails about.
+type ActivityType struct {
+	Key     string
+	Label   string
+	Default string // Frequency used until the user chooses one
+}
+
+// ActivityTypes lists every activity type in the order shown on the settings page.
+var ActivityTypes = []ActivityType{
+	{TypeReplyToPost, "Replies to my posts", Daily},
+	{TypeReplyToComment, "Replies to my replies", Daily},
+	{TypeMention, "Mentions of me", Immediate},
+	{TypeLike, "Likes on my posts and replies", Off},
+	{TypeModeration, "Moderator actions on my posts", Immediate},
+	{TypeThreadReplies, "New replies in threads I watch", Daily},
+	{TypeCategoryThreads, "New threads in categories I watch", Weekly},
+}
+
+// SiteURL is the address used in links in emails. It can be changed with the
+// SITE_URL environment variable.
+var SiteURL = env.String("SITE_URL", "http://localhost:8080")
+
+// activityType returns the activity type with the given key.
+func activityType(key string) (ActivityType, bool) {
+	for _, t := range ActivityTypes {
+		if t.Key == key {
+			return t, true
+		}
+	}
+	return ActivityType{}, false
+}
+
+// validFrequency reports whether the frequency is one of Frequencies.
+func validFrequency(frequency string) bool {
+	for _, f := range Frequencies {
+		if f == frequency {
+			return true
+		}
+	}
+	return false
+}
+
+// Preferences returns the email frequency for every activity type of a user,
+// filling in the defaults for types the user hasn't chosen a frequency for.
+func Preferences(userID int) (map[string]string, error) {
+	preferences := map[string]string{}
+	for _, t := range ActivityTypes {
+		preferences[t.Key] = t.Default
+	}
+
+	rows, err := database.DB.Query(`SELECT Type, Frequency FROM EmailPreference WHERE UserID = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, frequency string
+		if err := rows.Scan(&key, &frequency); err != nil {
+			return nil, err
+		}
+		if _, ok := activityType(key); ok && validFrequency(frequency) {
+			preferences[key] = frequency
+		}
+	}
+	return preferences, rows.Err()
+}
+
+// Preference returns a user's email frequency for one activity type.
+func Preference(userID int, key string) (string, error) {
+	preferences, err := Preferences(userID)
+	if err != nil {
+		return "", err
+	}
+	return preferences[key], nil
+}
+
+// SetPreference stores a user's email frequency for one activity type.
+// Unknown types and frequencies are ignored.
+func SetPreference(userID int, key, frequency string) error {
+	if _, ok := activityType(key); !ok || !validFrequency(frequency) {
+		return nil
+	}
+	_, err := database.DB.Exec(`INSERT OR REPLACE INTO EmailPreference (UserID, Type, Frequency) VALUES (?, ?, ?)`,
+		userID, key, frequency)
+	return err
+}
+
+// UnsubscribeURL returns the one-click link that turns off emails about one
+// activity type, or about everything when key is empty.
+func UnsubscribeURL(userID int, key string) (string, error) {
+	token, err := unsubscribeToken(userID)
+	if err != nil {
+		return "", err
+	}
+	link := SiteURL + "/email/unsubscribe?token=" + url.QueryEscape(token)
+	if key != "" {
+		link += "&type=" + url.QueryEscape(key)
+	}
+	return link, nil
+}
+
+// unsubscribeToken returns the secret token identifying a user in unsubscribe
+// links, creating it the first time it is needed.
+func unsubscribeToken(userID int) (string, error) {
+	var token sql.NullString
+	err := database.DB.QueryRow(`SELECT UnsubscribeToken FROM User WHERE UserID = ?`, userID).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+	if token.Valid && token.String != "" {
+		return token.String, nil
+	}
+
+	newToken := uuid.New().String()
+	_, err = database.DB.Exec(`UPDATE User SET UnsubscribeToken = ? WHERE UserID = ?`, newToken, userID)
+	return newToken, err
+}
+
+// SendToUser emails a user about an activity, adding unsubscribe links for
+// the activity type to the message. Failures are logged.
+func SendToUser(userID int, key, subject, body string) {
+	var address string
+	err := database.DB.QueryRow(`SELECT Email FROM User WHERE UserID = ?`, userID).Scan(&address)
+	if err != nil {
+		log.Printf("Error fetching email address of user %d: %v", userID, err)
+		return
+	}
+
+	unsubscribe, err := UnsubscribeURL(userID, key)
+	if err != nil {
+		log.Printf("Error creating unsubscribe link for user %d: %v", userID, err)
+		return
+	}
+	settings := SiteURL + "/settings/email"
+	body += "\n\n--\nTo stop these emails, open " + unsubscribe + "\nTo choose which emails you get, visit " + settings + "\n"
+
+	headers := map[string]string{
+		"MIME-Version":          "1.0",
+		"Content-Type":          "text/plain; charset=UTF-8",
+		"List-Unsubscribe":      "<" + unsubscribe + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	subject = mime.QEncoding.Encode("utf-8", subject)
+	if err := SendEmailWithHeaders(address, subject, body, headers); err != nil {
+		log.Printf("Failed to send email %q to user %d: %v", subject, userID, err)
+	}
+}
+
+// NotifyImmediately emails a user about a new notification when they chose
+// immediate emails for its type. The email is sent in the background.
+func NotifyImmediately(userID int, key, text, link string) {
+	frequency, err := Preference(userID, key)
+	if err != nil {
+		log.Printf("Error fetching email preference of user %d: %v", userID, err)
+		return
+	}
+	if frequency != Immediate {
+		return
+	}
+
+	body := text + "\n\n" + SiteURL + link
+	go SendToUser(userID, key, "Literary Lions: "+text, body)
+}
@@ -0,0 +1,90 @@
+// env.go
+package env
+
+import (
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Settings read from the environment fall back to their default when the
+// variable is unset or invalid, and log why an invalid value was ignored.
+// Negative durations and counts are invalid; 0 is a valid value that each
+// setting documents the meaning of, usually "off".
+
+// Duration reads a non-negative duration such as "90s" or "48h".
+func Duration(name string, def time.Duration) time.Duration {
+	return duration(name, def, 0)
+}
+
+// PositiveDuration reads a duration that must be above 0, such as how often
+// a background job runs.
+func PositiveDuration(name string, def time.Duration) time.Duration {
+	return duration(name, def, 1)
+}
+
+func duration(name string, def, min time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < min {
+		log.Printf("Invalid %s %q, using %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// Int reads a non-negative integer.
+func Int(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s %q, using %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+// String reads a string, falling back to def when the variable is unset or
+// empty.
+func String(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Float reads a finite number, which may be negative.
+func Float(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		log.Printf("Invalid %s %q, using %v", name, value, def)
+		return def
+	}
+	return f
+}
+
+// Bool reads a boolean such as "true", "false", "1" or "0".
+func Bool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %t", name, value, def)
+		return def
+	}
+	return b
+}
@@ -10,6 +10,7 @@ import (
 
 	//"strconv"
 	"lions/session"
+	"lions/upload"
 	"log"
 	"net/http"
 	"strings"
@@ -77,7 +78,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Insert the new user into the database
-		_, err = database.DB.Exec(`INSERT INTO User (Username, Email, Password) VALUES (?, ?, ?)`, name, emailAddr, hashedPassword)
+		_, err = database.DB.Exec(`INSERT INTO User (Username, Email, Password, CreatedAt) VALUES (?, ?, ?, ?)`, name, emailAddr, hashedPassword, time.Now())
 		if err != nil {
 			var errorMessage string
 			if sqliteErr, ok := err.(sqlite3.Error); ok {
@@ -478,7 +479,7 @@ func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the user's account from the database
-	_, err = database.DB.Exec(`DELETE FROM User WHERE Username = ?`, sessionData.Username)
+	err = deleteAccount(sessionData.UserID)
 	log.Printf("User deleted: %s", sessionData.Username)
 	if err != nil {
 		log.Println("Error deleting user:", err)
@@ -501,6 +502,39 @@ func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
+// deleteAccount deletes a user together with the rows only they use and their
+// profile picture. Foreign keys aren't enforced, so these rows are removed
+// here rather than by the schema.
+func deleteAccount(userID int) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	var avatarPath sql.NullString
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			upload.RemoveUnused([]string{avatarPath.String})
+		}
+	}()
+
+	err = tx.QueryRow(`SELECT AvatarPath FROM User WHERE UserID = ?`, userID).Scan(&avatarPath)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"Draft", "Mention", "Notification", "EmailPreference", "EmailDigest",
+		"PostWatch", "CategoryWatch", "ReadMarker", "ReadingProgress", "PollBallot", "PollVote"} {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE UserID = ?", userID); err != nil {
+			log.Printf("Error deleting %s rows for user ID: %d", table, userID)
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM User WHERE UserID = ?`, userID)
+	return err
+}
+
 /*
 func ConfirmDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	postID := r.URL.Query().Get("post_id")
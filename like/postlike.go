@@ -3,6 +3,8 @@ package like
 import (
 	"database/sql"
 	"lions/database"
+	"lions/notification"
+	"lions/reputation"
 	"lions/session"
 	"log"
 	"net/http"
@@ -35,22 +37,47 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked and archived threads don't accept new likes
+	err = database.CheckPostOpen(postIDStr)
+	if err == database.ErrPostClosed {
+		http.Error(w, "This thread is locked and no longer accepts likes", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
 	// Call function to handle the like/dislike action
-	err = handleLikeDislike(userID, postIDStr, isLike)
+	liked, err := handleLikeDislike(userID, postIDStr, isLike)
 	if err != nil {
 		http.Error(w, "Error processing like/dislike", http.StatusInternalServerError)
 		return
 	}
 
+	// The vote counts towards the author's reputation, and the author hears
+	// about new likes
+	var authorID sql.NullInt64
+	if err := database.DB.QueryRow("SELECT UserID FROM Post WHERE PostID = ?", postIDStr).Scan(&authorID); err == nil {
+		if err := reputation.Update(int(authorID.Int64)); err != nil {
+			log.Printf("Error updating reputation of user %d: %v", authorID.Int64, err)
+		}
+		if liked {
+			notification.SendLike(int(authorID.Int64), userID, postIDStr, "")
+		}
+	}
+
 	// Redirect back to the post view to show updated like/dislike count
 	http.Redirect(w, r, "/post/view?id="+postIDStr, http.StatusSeeOther)
 }
 
-func handleLikeDislike(userID int, postID string, isLike bool) error {
+// handleLikeDislike records the user's like or dislike of a post and reports
+// whether it added a like.
+func handleLikeDislike(userID int, postID string, isLike bool) (liked bool, err error) {
 	tx, err := database.DB.Begin()
 	if err != nil {
 		log.Printf("Failed to begin transaction: %v", err)
-		return err
+		return false, err
 	}
 	defer func() {
 		if err != nil {
@@ -64,7 +91,7 @@ func handleLikeDislike(userID int, postID string, isLike bool) error {
 	existingAction, err := getUserPostAction(userID, postID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Printf("Error retrieving user action: %v", err)
-		return err
+		return false, err
 	}
 
 	// Handle new action or change of action
@@ -73,38 +100,40 @@ func handleLikeDislike(userID int, postID string, isLike bool) error {
 		err = insertLikeDislikeTx(tx, userID, postID, isLike)
 		if err != nil {
 			log.Printf("Error inserting like/dislike: %v", err)
-			return err
+			return false, err
 		}
 		// Update post counters (increment)
 		err = updatePostCountersTx(tx, postID, isLike, true)
+		return err == nil && isLike, err
 	} else {
 		// User is switching from like to dislike or vice versa
 		if (existingAction == "like" && !isLike) || (existingAction == "dislike" && isLike) {
 			err = updateLikeDislikeTx(tx, userID, postID, isLike)
 			if err != nil {
 				log.Printf("Error updating like/dislike: %v", err)
-				return err
+				return false, err
 			}
 			// Update post counters accordingly
 			err = updatePostCountersTx(tx, postID, isLike, true) // Increment the new action
 			if err != nil {
 				log.Printf("Error incrementing post counter: %v", err)
-				return err
+				return false, err
 			}
 			err = updatePostCountersTx(tx, postID, !isLike, false) // Decrement the old action
+			return err == nil && isLike, err
 		}
 	}
 
-	return err
+	return false, err
 }
 
 func insertLikeDislikeTx(tx *sql.Tx, userID int, postID string, isLike bool) error {
-	_, err := tx.Exec("INSERT INTO PostLikes (UserID, PostID, IsLike) VALUES (?, ?, ?)", userID, postID, isLike)
+	_, err := tx.Exec("INSERT INTO PostLikes (UserID, PostID, IsLike, CreatedAt) VALUES (?, ?, ?, CURRENT_TIMESTAMP)", userID, postID, isLike)
 	return err
 }
 
 func updateLikeDislikeTx(tx *sql.Tx, userID int, postID string, isLike bool) error {
-	_, err := tx.Exec("UPDATE PostLikes SET IsLike = ? WHERE UserID = ? AND PostID = ?", isLike, userID, postID)
+	_, err := tx.Exec("UPDATE PostLikes SET IsLike = ?, CreatedAt = CURRENT_TIMESTAMP WHERE UserID = ? AND PostID = ?", isLike, userID, postID)
 	return err
 }
 
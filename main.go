@@ -1,54 +1,126 @@
 package main
 
 import (
+	"lions/category"
 	"lions/comment"
 	"lions/database"
+	"lions/digest"
+	"lions/draft"
+	"lions/email"
 	"lions/handle"
 	"lions/like"
+	"lions/mention"
+	"lions/moderate"
+	"lions/notification"
+	"lions/poll"
 	"lions/post"
+	"lions/profile"
+	"lions/progress"
+	"lions/ratelimit"
+	"lions/readmark"
+	"lions/reputation"
+	"lions/search"
 	"lions/session"
+	"lions/tag"
+	"lions/upload"
+	"lions/watch"
 	"log"
 	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
 	// Initialize the database connection.
 	database.Init()
 
+	// "lions recompute-reputation" recomputes every member's reputation and exits
+	if len(os.Args) > 1 && os.Args[1] == "recompute-reputation" {
+		if err := reputation.RecomputeAll(time.Now()); err != nil {
+			log.Fatalf("Error recomputing reputation: %v", err)
+		}
+		log.Println("Reputation recomputed.")
+		return
+	}
+
+	category.Init()
+	search.Init()
+	upload.Init()
+	digest.Start()
+	post.StartScheduler()
+	reputation.Start()
+
 	// Serve static files
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 	http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("./images"))))
 
 	// Apply session middleware to the uploads route
-	http.Handle("/uploads/", session.SessionMiddleware(http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads")))))
+	http.Handle("/uploads/", session.SessionMiddleware(http.HandlerFunc(upload.Handler)))
 
 	// Apply session middleware to all routes
 	http.Handle("/", session.SessionMiddleware(http.HandlerFunc(handle.MainPageHandler)))
-	http.Handle("/register", session.SessionMiddleware(http.HandlerFunc(handle.RegisterHandler)))
-	http.Handle("/login", session.SessionMiddleware(http.HandlerFunc(handle.LoginHandler)))
+	http.Handle("/register", session.SessionMiddleware(ratelimit.Limit(ratelimit.AccountRule, http.HandlerFunc(handle.RegisterHandler))))
+	http.Handle("/login", session.SessionMiddleware(ratelimit.Limit(ratelimit.AccountRule, http.HandlerFunc(handle.LoginHandler))))
 	http.Handle("/logout", session.SessionMiddleware(http.HandlerFunc(handle.LogoutHandler)))
 	http.Handle("/profile", session.SessionMiddleware(http.HandlerFunc(handle.ProfileHandler)))
+	http.Handle("/u/", session.SessionMiddleware(http.HandlerFunc(profile.PageHandler)))
+	http.Handle("/profile/edit", session.SessionMiddleware(http.HandlerFunc(profile.EditHandler)))
+	http.Handle("/profile/avatar", session.SessionMiddleware(ratelimit.Limit(ratelimit.AvatarRule, http.HandlerFunc(profile.AvatarHandler))))
 
-	http.Handle("/post/create", session.SessionMiddleware(http.HandlerFunc(post.CreatePost)))
+	http.Handle("/post/create", session.SessionMiddleware(ratelimit.Limit(ratelimit.CreatePostRule, http.HandlerFunc(post.CreatePost))))
 	http.Handle("/post/view", session.SessionMiddleware(http.HandlerFunc(post.ViewPost)))
 
 	http.Handle("/post", session.SessionMiddleware(http.HandlerFunc(post.ListPosts)))
-	http.Handle("/categories", session.SessionMiddleware(http.HandlerFunc(post.CategoriesHandler)))
+	http.Handle("/my-posts", session.SessionMiddleware(http.HandlerFunc(post.MyPostsHandler)))
+	http.Handle("/categories", session.SessionMiddleware(http.HandlerFunc(post.CategoryIndexHandler)))
+	http.Handle("/c/", session.SessionMiddleware(http.HandlerFunc(post.CategoryPostsHandler)))
+	http.Handle("/categories/mark-read", session.SessionMiddleware(http.HandlerFunc(readmark.CategoryHandler)))
+	http.Handle("/tag/", session.SessionMiddleware(http.HandlerFunc(post.TagPostsHandler)))
+	http.HandleFunc("/tags/autocomplete", tag.AutocompleteHandler)
+	http.HandleFunc("/users/search", mention.AutocompleteHandler)
+	http.Handle("/search", session.SessionMiddleware(http.HandlerFunc(search.SearchHandler)))
 
-	http.Handle("/post/reply", session.SessionMiddleware(http.HandlerFunc(post.AddReply)))
+	http.Handle("/poll/vote", session.SessionMiddleware(ratelimit.Limit(ratelimit.LikeRule, http.HandlerFunc(poll.VoteHandler))))
+	http.Handle("/post/reply", session.SessionMiddleware(ratelimit.Limit(ratelimit.ReplyRule, http.HandlerFunc(post.AddReply))))
 	http.Handle("/post/delete", session.SessionMiddleware(http.HandlerFunc(post.DeletePostHandler)))
-	http.Handle("/like", session.SessionMiddleware(http.HandlerFunc(like.LikeHandler)))
-	http.Handle("/like/comment", session.SessionMiddleware(http.HandlerFunc(comment.CommentLikeHandler)))
+	http.Handle("/like", session.SessionMiddleware(ratelimit.Limit(ratelimit.LikeRule, http.HandlerFunc(like.LikeHandler))))
+	http.Handle("/like/comment", session.SessionMiddleware(ratelimit.Limit(ratelimit.LikeRule, http.HandlerFunc(comment.CommentLikeHandler))))
 
 	http.Handle("/post/edit", session.SessionMiddleware(http.HandlerFunc(post.EditPostHandler)))
 	http.Handle("/reply/edit", session.SessionMiddleware(http.HandlerFunc(post.EditReplyHandler)))
+	http.Handle("/post/moderate", session.SessionMiddleware(http.HandlerFunc(moderate.PostStateHandler)))
+	http.Handle("/post/move", session.SessionMiddleware(http.HandlerFunc(moderate.MovePostHandler)))
+	http.Handle("/post/merge", session.SessionMiddleware(http.HandlerFunc(moderate.MergePostHandler)))
+
+	http.Handle("/notifications", session.SessionMiddleware(http.HandlerFunc(notification.PageHandler)))
+	http.Handle("/notifications/count", session.SessionMiddleware(http.HandlerFunc(notification.CountHandler)))
+	http.Handle("/notifications/open", session.SessionMiddleware(http.HandlerFunc(notification.OpenHandler)))
+	http.Handle("/notifications/read", session.SessionMiddleware(http.HandlerFunc(notification.ReadHandler)))
+	http.Handle("/notifications/read-all", session.SessionMiddleware(http.HandlerFunc(notification.ReadAllHandler)))
+
+	http.Handle("/watching", session.SessionMiddleware(http.HandlerFunc(watch.PageHandler)))
+	http.Handle("/watch/post", session.SessionMiddleware(http.HandlerFunc(watch.PostHandler)))
+	http.Handle("/watch/category", session.SessionMiddleware(http.HandlerFunc(watch.CategoryHandler)))
+
+	http.Handle("/reading-progress", session.SessionMiddleware(http.HandlerFunc(progress.Handler)))
+
+	http.Handle("/drafts", session.SessionMiddleware(http.HandlerFunc(draft.PageHandler)))
+	http.Handle("/drafts/save", session.SessionMiddleware(http.HandlerFunc(draft.SaveHandler)))
+	http.Handle("/drafts/delete", session.SessionMiddleware(http.HandlerFunc(draft.DeleteHandler)))
+
+	http.Handle("/settings/email", session.SessionMiddleware(http.HandlerFunc(email.SettingsHandler)))
+
+	http.Handle("/admin/categories", session.SessionMiddleware(http.HandlerFunc(category.AdminHandler)))
+	http.Handle("/admin/categories/save", session.SessionMiddleware(http.HandlerFunc(category.SaveHandler)))
+	http.Handle("/admin/categories/merge", session.SessionMiddleware(http.HandlerFunc(category.MergeHandler)))
 	
 
 	// Define routes that do not use session middleware
 	http.HandleFunc("/confirm", handle.ConfirmEmailHandler)
-	http.HandleFunc("/password-reset-request", handle.PasswordResetRequestHandler)
+	http.Handle("/password-reset-request", ratelimit.Limit(ratelimit.AccountRule, http.HandlerFunc(handle.PasswordResetRequestHandler)))
 	http.HandleFunc("/reset-password", handle.ResetPasswordHandler)
 	http.HandleFunc("/delete-account", handle.DeleteAccountHandler)
+	http.HandleFunc("/email/unsubscribe", email.UnsubscribeHandler)
 
 	http.Handle("/filter", session.SessionMiddleware(http.HandlerFunc(post.FilterPostHandler)))
 
@@ -0,0 +1,46 @@
+// markdown.go
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"log"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// md converts Markdown to HTML. Raw HTML in the source is passed through and
+// left to the sanitiser, and single line breaks are kept because posts written
+// before Markdown rely on them.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify, Spoilers),
+	goldmark.WithRendererOptions(gmhtml.WithHardWraps(), gmhtml.WithUnsafe()),
+)
+
+// policy is the allowlist every rendered post and comment goes through: the
+// usual user-generated content elements plus collapsible spoilers.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowElements("details", "summary")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("details", "span")
+	p.AllowAttrs("tabindex").Matching(regexp.MustCompile(`^0$`)).OnElements("span")
+	p.AllowAttrs("title").OnElements("span")
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// Render converts Markdown to sanitised HTML that is safe to put on a page.
+func Render(source string) string {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		log.Printf("Error rendering Markdown: %v", err)
+		return "<p>" + html.EscapeString(source) + "</p>"
+	}
+	return policy.Sanitize(buf.String())
+}
@@ -0,0 +1,120 @@
+package markdown
+
+import (
+	"database/sql"
+	"lions/database"
+	"lions/mention"
+	"strings"
+	"testing"
+)
+
+// The rendered HTML goes into pages as template.HTML, so anything the
+// sanitiser lets through runs in readers' browsers.
+func TestRenderSanitises(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		forbidden []string // Must not appear in the output
+		want      []string // Must appear in the output
+	}{
+		{
+			name:      "script element",
+			source:    "hello <script>alert(1)</script> world",
+			forbidden: []string{"<script", "alert(1)"},
+			want:      []string{"hello", "world"},
+		},
+		{
+			name:      "event handler attribute",
+			source:    `<img src="x.png" onerror="alert(1)">`,
+			forbidden: []string{"onerror", "alert(1)"},
+		},
+		{
+			name:      "javascript link in Markdown",
+			source:    "[click](javascript:alert(1))",
+			forbidden: []string{"javascript:"},
+			want:      []string{"click"},
+		},
+		{
+			name:      "javascript link in HTML",
+			source:    `<a href="javascript:alert(1)">click</a>`,
+			forbidden: []string{"javascript:"},
+			want:      []string{"click"},
+		},
+		{
+			name:      "details with a foreign class",
+			source:    `<details class="x" open onclick="alert(1)"><summary>s</summary>body</details>`,
+			forbidden: []string{`class="x"`, "onclick", "alert(1)"},
+			want:      []string{"<details", "<summary>s</summary>"},
+		},
+		{
+			name:   "spoiler block keeps its class",
+			source: "[spoiler]\nhidden\n[/spoiler]",
+			want:   []string{`<details class="spoiler">`},
+		},
+		{
+			name:      "style element",
+			source:    "<style>body{display:none}</style>text",
+			forbidden: []string{"<style", "display:none"},
+			want:      []string{"text"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.source)
+			for _, s := range tt.forbidden {
+				if strings.Contains(got, s) {
+					t.Errorf("Render(%q) = %q, contains %q", tt.source, got, s)
+				}
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("Render(%q) = %q, missing %q", tt.source, got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestLinkifyLeavesLinksAndCodeAlone(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // Every connection to :memory: is a separate database
+	if _, err := db.Exec(`
+        CREATE TABLE User (UserID INTEGER PRIMARY KEY, Username TEXT NOT NULL);
+        INSERT INTO User (UserID, Username) VALUES (1, 'alice');`); err != nil {
+		t.Fatal(err)
+	}
+	saved := database.DB
+	database.DB = db
+	defer func() { database.DB = saved }()
+
+	got := mention.Linkify(Render("hi @alice, `@alice` and [@alice](https://example.com) but not @nobody\n\n    @alice in a code block"))
+
+	if n := strings.Count(got, `<a class="mention"`); n != 1 {
+		t.Errorf("got %d mention links, want 1 in %q", n, got)
+	}
+	if !strings.Contains(got, `<a class="mention" href="/u/alice">@alice</a>`) {
+		t.Errorf("mention in text not linked: %q", got)
+	}
+	if !strings.Contains(got, "<code>@alice</code>") {
+		t.Errorf("mention in code changed: %q", got)
+	}
+	if !strings.Contains(got, `<a href="https://example.com" rel="nofollow noopener" target="_blank">@alice</a>`) {
+		t.Errorf("mention inside a link changed: %q", got)
+	}
+	if !strings.Contains(got, "<pre><code>@alice in a code block") {
+		t.Errorf("mention in a code block changed: %q", got)
+	}
+	if strings.Contains(got, "/u/nobody") {
+		t.Errorf("unknown user linked: %q", got)
+	}
+
+	// Text is escaped again after linking
+	got = mention.Linkify(Render("@alice &lt;script&gt;"))
+	if strings.Contains(got, "<script") {
+		t.Errorf("Linkify unescaped text: %q", got)
+	}
+}
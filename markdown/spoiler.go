@@ -0,0 +1,268 @@
+// spoiler.go
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindSpoilerBlock is the node kind of spoiler blocks.
+var KindSpoilerBlock = ast.NewNodeKind("SpoilerBlock")
+
+// SpoilerBlock is a block of Markdown hidden until the reader opens it.
+type SpoilerBlock struct {
+	ast.BaseBlock
+}
+
+// Kind implements ast.Node.Kind.
+func (n *SpoilerBlock) Kind() ast.NodeKind {
+	return KindSpoilerBlock
+}
+
+// Dump implements ast.Node.Dump.
+func (n *SpoilerBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// spoilerBlockParser parses blocks of lines starting with ">!", written like
+// a quote:
+//
+//	>! Snape kills Dumbledore.
+//	>! Then he flees.
+type spoilerBlockParser struct{}
+
+// process consumes the ">!" marker and following space of the current line,
+// returning false when the line doesn't start with one.
+func (p *spoilerBlockParser) process(reader text.Reader) bool {
+	line, _ := reader.PeekLine()
+	w, pos := util.IndentWidth(line, reader.LineOffset())
+	if w > 3 || pos+1 >= len(line) || line[pos] != '>' || line[pos+1] != '!' {
+		return false
+	}
+	pos += 2
+	if pos < len(line) && (line[pos] == ' ' || line[pos] == '\t') {
+		pos++
+	}
+	reader.Advance(pos)
+	return true
+}
+
+func (p *spoilerBlockParser) Trigger() []byte {
+	return []byte{'>'}
+}
+
+func (p *spoilerBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	if p.process(reader) {
+		return &SpoilerBlock{}, parser.HasChildren
+	}
+	return nil, parser.NoChildren
+}
+
+func (p *spoilerBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if p.process(reader) {
+		return parser.Continue | parser.HasChildren
+	}
+	return parser.Close
+}
+
+func (p *spoilerBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *spoilerBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *spoilerBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// Markers of spoilers written with tags.
+const (
+	openTag  = "[spoiler]"
+	closeTag = "[/spoiler]"
+)
+
+// spoilerTagBlockParser parses spoiler blocks written with tags on lines of
+// their own, which may span several paragraphs:
+//
+//	[spoiler]
+//	Snape kills Dumbledore.
+//	[/spoiler]
+type spoilerTagBlockParser struct{}
+
+// isTagLine reports whether the current line holds nothing but the tag, and
+// if so moves past it.
+func isTagLine(reader text.Reader, tag string) bool {
+	line, _ := reader.PeekLine()
+	w, pos := util.IndentWidth(line, reader.LineOffset())
+	if w > 3 || !bytes.EqualFold(bytes.TrimSpace(line[pos:]), []byte(tag)) {
+		return false
+	}
+	reader.Advance(len(line) - 1)
+	return true
+}
+
+func (p *spoilerTagBlockParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *spoilerTagBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	if isTagLine(reader, openTag) {
+		return &SpoilerBlock{}, parser.HasChildren
+	}
+	return nil, parser.NoChildren
+}
+
+func (p *spoilerTagBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if isTagLine(reader, closeTag) {
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (p *spoilerTagBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *spoilerTagBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *spoilerTagBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// KindSpoiler is the node kind of inline spoilers.
+var KindSpoiler = ast.NewNodeKind("Spoiler")
+
+// Spoiler is inline text hidden until the reader clicks it.
+type Spoiler struct {
+	ast.BaseInline
+}
+
+// Kind implements ast.Node.Kind.
+func (n *Spoiler) Kind() ast.NodeKind {
+	return KindSpoiler
+}
+
+// Dump implements ast.Node.Dump.
+func (n *Spoiler) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// spoilerDelimiters pairs the delimiters of inline spoilers: "||" with "||"
+// and "[spoiler]" with "[/spoiler]", which are both stored with the '[' char.
+type spoilerDelimiters struct{}
+
+func (p *spoilerDelimiters) IsDelimiter(b byte) bool {
+	return b == '|'
+}
+
+func (p *spoilerDelimiters) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char
+}
+
+func (p *spoilerDelimiters) OnMatch(consumes int) ast.Node {
+	return &Spoiler{}
+}
+
+// spoilerInlineParser parses inline spoilers, ||like this|| or
+// [spoiler]like this[/spoiler].
+type spoilerInlineParser struct{}
+
+func (p *spoilerInlineParser) Trigger() []byte {
+	return []byte{'|', '['}
+}
+
+func (p *spoilerInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+
+	if line[0] == '[' {
+		// A tag counts as a single delimiter character, so it is consumed
+		// as a whole when matched and kept as text when not
+		var node *parser.Delimiter
+		switch {
+		case hasPrefixFold(line, openTag):
+			node = parser.NewDelimiter(true, false, 1, '[', &spoilerDelimiters{})
+			node.Segment = segment.WithStop(segment.Start + len(openTag))
+		case hasPrefixFold(line, closeTag):
+			node = parser.NewDelimiter(false, true, 1, '[', &spoilerDelimiters{})
+			node.Segment = segment.WithStop(segment.Start + len(closeTag))
+		default:
+			return nil
+		}
+		block.Advance(node.Segment.Len())
+		pc.PushDelimiter(node)
+		return node
+	}
+
+	before := block.PrecendingCharacter()
+	node := parser.ScanDelimiter(line, before, 2, &spoilerDelimiters{})
+	if node == nil || node.OriginalLength != 2 || before == '|' {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+func (p *spoilerInlineParser) CloseBlock(parent ast.Node, pc parser.Context) {}
+
+// hasPrefixFold reports whether line starts with prefix, ignoring case.
+func hasPrefixFold(line []byte, prefix string) bool {
+	return len(line) >= len(prefix) && bytes.EqualFold(line[:len(prefix)], []byte(prefix))
+}
+
+// spoilerRenderer renders spoiler blocks as collapsed <details> elements and
+// inline spoilers as blacked-out text that is revealed by clicking it.
+type spoilerRenderer struct{}
+
+func (r *spoilerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindSpoilerBlock, r.renderSpoilerBlock)
+	reg.Register(KindSpoiler, r.renderSpoiler)
+}
+
+func (r *spoilerRenderer) renderSpoilerBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<details class=\"spoiler\"><summary>Spoiler</summary>\n")
+	} else {
+		_, _ = w.WriteString("</details>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *spoilerRenderer) renderSpoiler(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<span class=\"spoiler\" tabindex=\"0\" title=\"Spoiler: click to reveal\">")
+	} else {
+		_, _ = w.WriteString("</span>")
+	}
+	return ast.WalkContinue, nil
+}
+
+type spoilers struct{}
+
+// Spoilers is the goldmark extension adding spoiler blocks and inline spoilers.
+var Spoilers goldmark.Extender = &spoilers{}
+
+func (e *spoilers) Extend(m goldmark.Markdown) {
+	// The block parsers run before the blockquote and paragraph parsers, which
+	// also start at '>' and '['
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(
+			util.Prioritized(&spoilerBlockParser{}, 750),
+			util.Prioritized(&spoilerTagBlockParser{}, 750),
+		),
+		parser.WithInlineParsers(
+			// Before the link parser, which also starts at '['
+			util.Prioritized(&spoilerInlineParser{}, 150),
+		),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&spoilerRenderer{}, 500),
+	))
+}
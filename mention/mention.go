@@ -0,0 +1,269 @@
+// mention.go
+package mention
+
+import (
+	"database/sql"
+	"encoding/json"
+	"lions/database"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// pattern matches @username mentions. Usernames containing spaces or other
+// punctuation cannot be mentioned.
+var pattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]+)`)
+
+// User is a user that can be mentioned.
+type User struct {
+	ID       int    `json:"-"`
+	Username string `json:"username"`
+}
+
+// names returns the distinct usernames mentioned in the text, in order of appearance.
+func names(text string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		name := trimName(match[2])
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// mentionable reports whether the whole username can be written as a mention.
+func mentionable(username string) bool {
+	found := names("@" + username)
+	return len(found) == 1 && found[0] == username
+}
+
+// trimName drops trailing dots and dashes, which usually end a sentence rather
+// than belong to the username.
+func trimName(name string) string {
+	return strings.TrimRight(name, ".-")
+}
+
+// lookup returns the users with the given usernames in one query, ignoring
+// names that don't belong to anyone. Usernames are matched case-insensitively.
+func lookup(names []string) (map[string]User, error) {
+	users := map[string]User{}
+	if len(names) == 0 {
+		return users, nil
+	}
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	rows, err := database.DB.Query(`
+        SELECT UserID, Username FROM User
+        WHERE Username COLLATE NOCASE IN (?`+strings.Repeat(", ?", len(names)-1)+`)
+        ORDER BY UserID`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		// Keep the oldest account when usernames only differ in case
+		key := strings.ToLower(user.Username)
+		if _, ok := users[key]; !ok {
+			users[key] = user
+		}
+	}
+	return users, rows.Err()
+}
+
+// Record replaces the mentions stored for a post body (commentID empty) or a
+// comment with the users mentioned in text, and returns the users who were not
+// mentioned there before. Authors mentioning themselves are ignored.
+func Record(postID, commentID string, authorID int, text string) (added []User, err error) {
+	users, err := lookup(names(text))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else if err = tx.Commit(); err != nil {
+			added = nil
+		}
+	}()
+
+	comment := sql.NullString{String: commentID, Valid: commentID != ""}
+
+	// Remember who was already mentioned so edits only report new mentions
+	previous := map[int]bool{}
+	rows, err := tx.Query(`SELECT UserID FROM Mention WHERE PostID = ? AND CommentID IS ?`, postID, comment)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		previous[id] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Mention WHERE PostID = ? AND CommentID IS ?`, postID, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if user.ID == authorID {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO Mention (UserID, AuthorID, PostID, CommentID) VALUES (?, ?, ?, ?)`,
+			user.ID, authorID, postID, comment)
+		if err != nil {
+			return nil, err
+		}
+		if !previous[user.ID] {
+			added = append(added, user)
+		}
+	}
+
+	return added, nil
+}
+
+// Linkify turns mentions of existing users in an HTML fragment, such as a
+// rendered post, into links. Text inside links and code is left alone.
+func Linkify(fragment string) string {
+	// Collect the text first so that all mentioned users are looked up at once
+	var text strings.Builder
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+		if tt == html.TextToken {
+			text.Write(z.Text())
+			text.WriteByte(' ')
+		}
+	}
+	users, err := lookup(names(text.String()))
+	if err != nil {
+		log.Printf("Error looking up mentioned users: %v", err)
+		return fragment
+	}
+	if len(users) == 0 {
+		return fragment
+	}
+
+	var b strings.Builder
+	skip := 0 // Depth of elements whose text must not get links
+	z = html.NewTokenizer(strings.NewReader(fragment))
+	for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+		switch tt {
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(linkifyText(string(z.Text()), users))
+				continue
+			}
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			if noLinks[string(name)] {
+				if tt == html.StartTagToken {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			}
+		}
+		b.Write(z.Raw())
+	}
+	return b.String()
+}
+
+// noLinks lists the elements whose text is never turned into mention links.
+var noLinks = map[string]bool{"a": true, "code": true, "pre": true}
+
+// linkifyText HTML-escapes plain text and turns mentions of the given users
+// into links.
+func linkifyText(text string, users map[string]User) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		// match[4]:match[5] is the name; the @ sits right before it
+		start := match[4] - 1
+		name := trimName(text[match[4]:match[5]])
+		user, ok := users[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		end := match[4] + len(name)
+
+		b.WriteString(html.EscapeString(text[last:start]))
+		b.WriteString(`<a class="mention" href="` + html.EscapeString(ProfileURL(user.Username)) + `">@` + html.EscapeString(user.Username) + `</a>`)
+		last = end
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// ProfileURL returns the public profile page of a user.
+func ProfileURL(username string) string {
+	return "/u/" + url.PathEscape(username)
+}
+
+// AutocompleteHandler returns, as JSON, up to ten usernames starting with the
+// query parameter q.
+func AutocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+
+	users := []User{}
+	if prefix != "" {
+		// Escape LIKE wildcards so they match literally
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+		rows, err := database.DB.Query(`
+            SELECT UserID, Username
+            FROM User
+            WHERE Username LIKE ? ESCAPE '\'
+            ORDER BY Username COLLATE NOCASE
+            LIMIT 20`, escaped)
+		if err != nil {
+			log.Printf("Error searching users: %v", err)
+			http.Error(w, "Could not search users", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() && len(users) < 10 {
+			var user User
+			if err := rows.Scan(&user.ID, &user.Username); err != nil {
+				log.Printf("Error scanning user: %v", err)
+				http.Error(w, "Could not search users", http.StatusInternalServerError)
+				return
+			}
+			// Only suggest usernames that can actually be mentioned
+			if !mentionable(user.Username) {
+				continue
+			}
+			users = append(users, user)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
@@ -0,0 +1,306 @@
+// merge.go
+package moderate
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/category"
+	"lions/database"
+	"lions/notification"
+	"lions/reputation"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// MovePostHandler handles moderator requests to move a post to another category.
+func MovePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	postID := r.FormValue("post_id")
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if postID == "" || err != nil {
+		http.Error(w, "Post ID and category are required", http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the category exists and still accepts posts before moving
+	// anything into it
+	target, err := category.GetByID(categoryID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking category %d: %v", categoryID, err)
+		http.Error(w, "Could not move post", http.StatusInternalServerError)
+		return
+	}
+	if target.Archived {
+		http.Error(w, "Posts cannot be moved into an archived category", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.DB.Exec(`UPDATE Post SET CategoryID = ? WHERE PostID = ?`, categoryID, postID)
+	if err != nil {
+		log.Printf("Error moving post %s: %v", postID, err)
+		http.Error(w, "Could not move post", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	notifyAuthor(userID, postID, "moved", " to "+target.Name)
+
+	log.Printf("Moderator %d moved post %s to category %d", userID, postID, categoryID)
+	http.Redirect(w, r, "/post/view?id="+url.QueryEscape(postID), http.StatusSeeOther)
+}
+
+// MergePostHandler handles moderator requests to merge a duplicate thread into another one.
+func MergePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	sourceID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	targetID, err := strconv.Atoi(r.FormValue("target_id"))
+	if err != nil {
+		http.Error(w, "Invalid target post ID", http.StatusBadRequest)
+		return
+	}
+	if sourceID == targetID {
+		http.Error(w, "A post cannot be merged into itself", http.StatusBadRequest)
+		return
+	}
+
+	// Look up the source post's author before the post is merged away
+	sourceAuthorID, sourceTitle, err := postAuthor(strconv.Itoa(sourceID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post %d: %v", sourceID, err)
+		http.Error(w, "Could not merge posts", http.StatusInternalServerError)
+		return
+	}
+
+	err = mergePosts(sourceID, targetID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error merging post %d into %d: %v", sourceID, targetID, err)
+		http.Error(w, "Could not merge posts", http.StatusInternalServerError)
+		return
+	}
+
+	targetAuthorID, targetTitle, err := postAuthor(strconv.Itoa(targetID))
+	if err == nil {
+		// The votes on the source post now count for the target's author
+		for _, authorID := range []int{sourceAuthorID, targetAuthorID} {
+			if err := reputation.Update(authorID); err != nil {
+				log.Printf("Error updating reputation of user %d: %v", authorID, err)
+			}
+		}
+		notification.Send(sourceAuthorID, userID, notification.TypeModeration, strconv.Itoa(targetID), "",
+			fmt.Sprintf("A moderator merged your post “%s” into “%s”", sourceTitle, targetTitle))
+	}
+
+	log.Printf("Moderator %d merged post %d into %d", userID, sourceID, targetID)
+	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", targetID), http.StatusSeeOther)
+}
+
+// mergePosts moves everything attached to the source post over to the target
+// post, deletes the source post and leaves a redirect behind. The source post's
+// own text is kept as a reply in the target thread.
+func mergePosts(sourceID, targetID int) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else if err = tx.Commit(); err != nil {
+			log.Printf("Failed to commit merge of post %d into %d: %v", sourceID, targetID, err)
+		}
+	}()
+
+	// Both posts have to exist
+	var targetExists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM Post WHERE PostID = ?)`, targetID).Scan(&targetExists)
+	if err != nil {
+		return err
+	}
+	if !targetExists {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	var source struct {
+		Title     string
+		Content   string
+		UserID    sql.NullInt64
+		CreatedAt sql.NullTime
+	}
+	err = tx.QueryRow(`SELECT Title, Content, UserID, CreatedAt FROM Post WHERE PostID = ?`, sourceID).
+		Scan(&source.Title, &source.Content, &source.UserID, &source.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Keep the opening post of the source thread as a reply in the target thread
+	result, err := tx.Exec(`INSERT INTO Comment (PostID, UserID, Content, CreatedAt) VALUES (?, ?, ?, ?)`,
+		targetID, source.UserID, source.Title+"\n\n"+source.Content, source.CreatedAt)
+	if err != nil {
+		return err
+	}
+	openingCommentID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	// Mentions in the opening post now live in that reply
+	_, err = tx.Exec(`UPDATE Mention SET PostID = ?, CommentID = ? WHERE PostID = ? AND CommentID IS NULL`,
+		targetID, openingCommentID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE Mention SET PostID = ? WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Re-parent the replies and images
+	_, err = tx.Exec(`UPDATE Comment SET PostID = ? WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE PostImage SET PostID = ? WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE CommentImage SET PostID = ? WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Combine the tags of both posts
+	_, err = tx.Exec(`INSERT OR IGNORE INTO PostTag (PostID, TagID) SELECT ?, TagID FROM PostTag WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM PostTag WHERE PostID = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Watchers of the source thread now watch the target thread
+	_, err = tx.Exec(`
+        INSERT OR IGNORE INTO PostWatch (UserID, PostID, LastVisitedAt, CreatedAt)
+        SELECT UserID, ?, LastVisitedAt, CreatedAt FROM PostWatch WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM PostWatch WHERE PostID = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Read markers of the source thread point at its old replies; the target
+	// thread's own markers decide what is unread from now on
+	_, err = tx.Exec(`DELETE FROM ReadMarker WHERE PostID = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// The poll moves to the target thread unless that has one of its own, in
+	// which case the source poll is dropped
+	for _, table := range []string{"PollBallot", "PollVote", "PollOption", "Poll"} {
+		_, err = tx.Exec(`UPDATE `+table+` SET PostID = ? WHERE PostID = ? AND NOT EXISTS (SELECT 1 FROM Poll WHERE PostID = ?)`,
+			targetID, sourceID, targetID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"PollBallot", "PollVote", "PollOption", "Poll"} {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE PostID = ?`, sourceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Unsent replies to the source thread are finished in the target thread
+	_, err = tx.Exec(`UPDATE Draft SET PostID = ? WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Combine likes; a user who voted on both posts keeps their vote on the target
+	_, err = tx.Exec(`
+        INSERT OR IGNORE INTO PostLikes (UserID, PostID, IsLike, CreatedAt)
+        SELECT UserID, ?, IsLike, CreatedAt FROM PostLikes WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM PostLikes WHERE PostID = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// Recalculate the counters and last reply of the surviving post
+	_, err = tx.Exec(`
+        UPDATE Post SET
+            LikesCount = (SELECT COUNT(*) FROM PostLikes WHERE PostID = Post.PostID AND IsLike = 1),
+            DislikesCount = (SELECT COUNT(*) FROM PostLikes WHERE PostID = Post.PostID AND IsLike = 0),
+            LastReplyDate = (SELECT MAX(CreatedAt) FROM Comment WHERE PostID = Post.PostID),
+            LastReplyUser = (SELECT u.Username FROM Comment c JOIN User u ON c.UserID = u.UserID
+                             WHERE c.PostID = Post.PostID ORDER BY c.CreatedAt DESC LIMIT 1)
+        WHERE PostID = ?`, targetID)
+	if err != nil {
+		return err
+	}
+
+	// Leave a redirect behind, and point older redirects at the surviving post
+	_, err = tx.Exec(`UPDATE PostRedirect SET NewPostID = ? WHERE NewPostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO PostRedirect (OldPostID, NewPostID) VALUES (?, ?)`, sourceID, targetID)
+	if err != nil {
+		return err
+	}
+
+	// Notifications about the source post now point at the surviving post
+	_, err = tx.Exec(`UPDATE Notification SET PostID = ? WHERE PostID = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Post WHERE PostID = ?`, sourceID)
+	return err
+}
@@ -0,0 +1,87 @@
+// moderate.go
+package moderate
+
+import (
+	"lions/database"
+	"lions/session"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// postStateActions maps each moderator action to the Post column it changes
+// and the value it sets.
+var postStateActions = map[string]struct {
+	Column string
+	Value  bool
+}{
+	"pin":       {"Pinned", true},
+	"unpin":     {"Pinned", false},
+	"lock":      {"Locked", true},
+	"unlock":    {"Locked", false},
+	"archive":   {"Archived", true},
+	"unarchive": {"Archived", false},
+}
+
+// PostStateHandler handles moderator requests to pin, lock or archive a post
+// and to undo those actions.
+func PostStateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	postID := r.FormValue("post_id")
+	action := r.FormValue("action")
+	state, ok := postStateActions[action]
+	if postID == "" || !ok {
+		http.Error(w, "Post ID and a valid action are required", http.StatusBadRequest)
+		return
+	}
+
+	// The column name comes from postStateActions, never from the request
+	result, err := database.DB.Exec(`UPDATE Post SET `+state.Column+` = ? WHERE PostID = ?`, state.Value, postID)
+	if err != nil {
+		log.Printf("Error applying %s to post %s: %v", action, postID, err)
+		http.Error(w, "Could not update post", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	notifyAuthor(userID, postID, actionDescriptions[action], "")
+
+	log.Printf("Moderator %d applied %s to post %s", userID, action, postID)
+	http.Redirect(w, r, "/post/view?id="+url.QueryEscape(postID), http.StatusSeeOther)
+}
+
+// requireModerator writes an error response and returns false unless the
+// request comes from a logged in moderator.
+func requireModerator(w http.ResponseWriter, r *http.Request) (int, bool) {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	userID, _ := r.Context().Value(session.UserID).(int)
+	if !authenticated {
+		http.Error(w, "Unauthorized: User not logged in", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	isModerator, err := database.IsModerator(userID)
+	if err != nil {
+		log.Printf("Error checking moderator role for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !isModerator {
+		http.Error(w, "Forbidden: Moderators only", http.StatusForbidden)
+		return 0, false
+	}
+
+	return userID, true
+}
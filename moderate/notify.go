@@ -0,0 +1,41 @@
+// notify.go
+package moderate
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"lions/notification"
+	"log"
+)
+
+// actionDescriptions describes each post state action in the notification
+// sent to the post's author.
+var actionDescriptions = map[string]string{
+	"pin":       "pinned",
+	"unpin":     "unpinned",
+	"lock":      "locked",
+	"unlock":    "unlocked",
+	"archive":   "archived",
+	"unarchive": "unarchived",
+}
+
+// postAuthor returns the author and title of a post.
+func postAuthor(postID string) (int, string, error) {
+	var authorID sql.NullInt64
+	var title string
+	err := database.DB.QueryRow(`SELECT UserID, Title FROM Post WHERE PostID = ?`, postID).Scan(&authorID, &title)
+	return int(authorID.Int64), title, err
+}
+
+// notifyAuthor tells the author of a post what a moderator did to it, as in
+// "A moderator <verb> your post “<title>”<suffix>".
+func notifyAuthor(moderatorID int, postID, verb, suffix string) {
+	authorID, title, err := postAuthor(postID)
+	if err != nil {
+		log.Printf("Error fetching author of post %s: %v", postID, err)
+		return
+	}
+	message := fmt.Sprintf("A moderator %s your post “%s”%s", verb, title, suffix)
+	notification.Send(authorID, moderatorID, notification.TypeModeration, postID, "", message)
+}
@@ -0,0 +1,188 @@
+// handlers.go
+package notification
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"lions/session"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// notificationsPerPage is the number of notifications shown per page.
+const notificationsPerPage = 20
+
+// PageData holds data for rendering the notifications page.
+type PageData struct {
+	Authenticated bool
+	Username      string
+	Notifications []Notification
+	Unread        int
+	Page          int
+	HasNext       bool
+}
+
+// PageHandler shows the logged in user's notifications, newest first.
+func PageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	// Fetch one extra notification to know whether there is a next page
+	notifications, err := List(userID, notificationsPerPage+1, (page-1)*notificationsPerPage)
+	if err != nil {
+		log.Printf("Error fetching notifications for user %d: %v", userID, err)
+		http.Error(w, "Could not fetch notifications", http.StatusInternalServerError)
+		return
+	}
+	hasNext := len(notifications) > notificationsPerPage
+	if hasNext {
+		notifications = notifications[:notificationsPerPage]
+	}
+
+	unread, err := UnreadCount(userID)
+	if err != nil {
+		log.Printf("Error counting notifications for user %d: %v", userID, err)
+		http.Error(w, "Could not fetch notifications", http.StatusInternalServerError)
+		return
+	}
+
+	data := PageData{
+		Authenticated: true,
+		Username:      r.Context().Value(session.Username).(string),
+		Notifications: notifications,
+		Unread:        unread,
+		Page:          page,
+		HasNext:       hasNext,
+	}
+
+	tmpl, err := template.New("notifications.html").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+		"sub": func(a, b int) int { return a - b },
+	}).ParseFiles("static/html/notifications.html")
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// CountHandler returns the number of unread notifications as JSON, for the
+// bell in the page header.
+func CountHandler(w http.ResponseWriter, r *http.Request) {
+	count := 0
+	if authenticated, _ := r.Context().Value(session.Authenticated).(bool); authenticated {
+		userID, _ := r.Context().Value(session.UserID).(int)
+		var err error
+		count, err = UnreadCount(userID)
+		if err != nil {
+			log.Printf("Error counting notifications for user %d: %v", userID, err)
+			http.Error(w, "Could not count notifications", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"unread": count})
+}
+
+// OpenHandler marks a notification as read and redirects to the content it is about.
+func OpenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	n, err := MarkRead(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking notification %d as read: %v", id, err)
+		http.Error(w, "Could not open notification", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, n.URL(), http.StatusSeeOther)
+}
+
+// ReadHandler marks a single notification as read.
+func ReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err = MarkRead(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking notification %d as read: %v", id, err)
+		http.Error(w, "Could not mark notification as read", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// ReadAllHandler marks every notification of the user as read.
+func ReadAllHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := MarkAllRead(userID); err != nil {
+		log.Printf("Error marking notifications of user %d as read: %v", userID, err)
+		http.Error(w, "Could not mark notifications as read", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// requireUser redirects to the login page and returns false unless the
+// request comes from a logged in user.
+func requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, false
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+	return userID, true
+}
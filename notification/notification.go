@@ -0,0 +1,257 @@
+// notification.go
+package notification
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"lions/email"
+	"log"
+	"strings"
+	"time"
+)
+
+// Notification types.
+const (
+	TypeReplyToPost     = "reply_post"       // Someone replied to the user's post
+	TypeReplyToComment  = "reply_comment"    // Someone replied to the user's comment
+	TypeMention         = "mention"          // Someone mentioned the user
+	TypeLike            = "like"             // Someone liked the user's post or comment
+	TypeModeration      = "moderation"       // A moderator acted on the user's post
+	TypeWatchedThread   = "thread_replies"   // Someone replied in a thread the user watches
+	TypeWatchedCategory = "category_threads" // Someone started a thread in a category the user watches
+)
+
+// Notification is a single entry in a user's notification center.
+type Notification struct {
+	ID        int
+	UserID    int    // Recipient
+	ActorID   int    // User whose action caused the notification
+	Actor     string // Username of the actor
+	Type      string
+	PostID    string
+	PostTitle string
+	CommentID string // Empty when the notification is about the post itself
+	Detail    string // Message for moderation notifications, category name for new threads
+	Count     int    // Number of batched actions, used for likes
+	IsRead    bool
+	CreatedAt time.Time
+}
+
+// Text describes the notification in a sentence.
+func (n Notification) Text() string {
+	title := "a deleted post"
+	if n.PostTitle != "" {
+		title = "“" + n.PostTitle + "”"
+	}
+	actor := n.Actor
+	if actor == "" {
+		actor = "Someone"
+	}
+
+	switch n.Type {
+	case TypeReplyToPost:
+		return fmt.Sprintf("%s replied to your post %s", actor, title)
+	case TypeReplyToComment:
+		return fmt.Sprintf("%s replied to your comment in %s", actor, title)
+	case TypeMention:
+		return fmt.Sprintf("%s mentioned you in %s", actor, title)
+	case TypeLike:
+		target := "your post"
+		if n.CommentID != "" {
+			target = "your comment in"
+		}
+		if n.Count > 1 {
+			others := "others"
+			if n.Count == 2 {
+				others = "other"
+			}
+			return fmt.Sprintf("%s and %d %s liked %s %s", actor, n.Count-1, others, target, title)
+		}
+		return fmt.Sprintf("%s liked %s %s", actor, target, title)
+	case TypeModeration:
+		return n.Detail
+	case TypeWatchedThread:
+		return fmt.Sprintf("%s replied in %s, a thread you watch", actor, title)
+	case TypeWatchedCategory:
+		return fmt.Sprintf("%s started %s in %s", actor, title, n.Detail)
+	}
+	return "Activity in " + title
+}
+
+// URL is the page the notification points to.
+func (n Notification) URL() string {
+	if n.PostID == "" {
+		return "/notifications"
+	}
+	if n.CommentID != "" {
+		return "/post/view?id=" + n.PostID + "#comment-" + n.CommentID
+	}
+	return "/post/view?id=" + n.PostID
+}
+
+// Send stores a notification for userID. Users are never notified about their
+// own actions. Notifications are best effort: failures are logged and never
+// stop the action that caused them.
+func Send(userID, actorID int, kind, postID, commentID, detail string) {
+	if userID == 0 || userID == actorID {
+		return
+	}
+	result, err := database.DB.Exec(`
+        INSERT INTO Notification (UserID, ActorID, Type, PostID, CommentID, Detail, CreatedAt)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, actorID, kind, nullable(postID), nullable(commentID), detail, time.Now())
+	if err != nil {
+		log.Printf("Error sending %s notification to user %d: %v", kind, userID, err)
+		return
+	}
+
+	// Email the notification right away to users who asked for that
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error retrieving new notification ID: %v", err)
+		return
+	}
+	n, err := get(int(id))
+	if err != nil {
+		log.Printf("Error fetching notification %d: %v", id, err)
+		return
+	}
+	email.NotifyImmediately(userID, kind, n.Text(), n.URL())
+}
+
+// SendLike notifies userID that actorID liked their post (commentID empty) or
+// comment. Likes on the same content are batched into one unread notification.
+func SendLike(userID, actorID int, postID, commentID string) {
+	if userID == 0 || userID == actorID {
+		return
+	}
+
+	result, err := database.DB.Exec(`
+        UPDATE Notification SET Count = Count + 1, ActorID = ?, CreatedAt = ?
+        WHERE UserID = ? AND Type = ? AND PostID = ? AND CommentID IS ? AND IsRead = 0`,
+		actorID, time.Now(), userID, TypeLike, postID, nullable(commentID))
+	if err != nil {
+		log.Printf("Error batching like notification for user %d: %v", userID, err)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+		return
+	}
+	Send(userID, actorID, TypeLike, postID, commentID, "")
+}
+
+// UnreadCount returns the number of unread notifications of a user.
+func UnreadCount(userID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM Notification WHERE UserID = ? AND IsRead = 0`, userID).Scan(&count)
+	return count, err
+}
+
+// selectNotifications selects notifications together with the actor's
+// username and the post title, in the column order expected by scan.
+const selectNotifications = `
+        SELECT n.NotificationID, n.UserID, COALESCE(n.ActorID, 0), COALESCE(u.Username, ''), n.Type,
+               COALESCE(n.PostID, ''), COALESCE(p.Title, ''), COALESCE(n.CommentID, ''),
+               n.Detail, n.Count, n.IsRead, n.CreatedAt
+        FROM Notification n
+        LEFT JOIN User u ON n.ActorID = u.UserID
+        LEFT JOIN Post p ON n.PostID = p.PostID`
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scan reads a notification selected with selectNotifications.
+func scan(row scanner) (Notification, error) {
+	var n Notification
+	err := row.Scan(&n.ID, &n.UserID, &n.ActorID, &n.Actor, &n.Type, &n.PostID, &n.PostTitle, &n.CommentID,
+		&n.Detail, &n.Count, &n.IsRead, &n.CreatedAt)
+	return n, err
+}
+
+// get returns the notification with the given ID.
+func get(id int) (Notification, error) {
+	return scan(database.DB.QueryRow(selectNotifications+` WHERE n.NotificationID = ?`, id))
+}
+
+// List returns one page of a user's notifications, newest first.
+func List(userID, limit, offset int) ([]Notification, error) {
+	rows, err := database.DB.Query(selectNotifications+`
+        WHERE n.UserID = ?
+        ORDER BY n.CreatedAt DESC, n.NotificationID DESC
+        LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		n, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// Since returns a user's unread notifications of the given types created after
+// the given time, oldest first.
+func Since(userID int, types []string, after time.Time) ([]Notification, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{userID, after}
+	placeholders := make([]string, len(types))
+	for i, kind := range types {
+		placeholders[i] = "?"
+		args = append(args, kind)
+	}
+
+	rows, err := database.DB.Query(selectNotifications+`
+        WHERE n.UserID = ? AND n.IsRead = 0 AND julianday(n.CreatedAt) > julianday(?) AND n.Type IN (`+strings.Join(placeholders, ", ")+`)
+        ORDER BY n.CreatedAt, n.NotificationID`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		n, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkRead marks one of the user's notifications as read and returns it.
+func MarkRead(userID, notificationID int) (Notification, error) {
+	var n Notification
+	err := database.DB.QueryRow(`
+        SELECT NotificationID, COALESCE(PostID, ''), COALESCE(CommentID, '')
+        FROM Notification WHERE NotificationID = ? AND UserID = ?`, notificationID, userID).
+		Scan(&n.ID, &n.PostID, &n.CommentID)
+	if err != nil {
+		return n, err
+	}
+
+	_, err = database.DB.Exec(`UPDATE Notification SET IsRead = 1 WHERE NotificationID = ?`, notificationID)
+	return n, err
+}
+
+// MarkAllRead marks every notification of the user as read.
+func MarkAllRead(userID int) error {
+	_, err := database.DB.Exec(`UPDATE Notification SET IsRead = 1 WHERE UserID = ? AND IsRead = 0`, userID)
+	return err
+}
+
+// nullable turns an empty ID into NULL.
+func nullable(id string) sql.NullString {
+	return sql.NullString{String: id, Valid: id != ""}
+}
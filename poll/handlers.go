@@ -0,0 +1,81 @@
+// handlers.go
+package poll
+
+import (
+	"database/sql"
+	"lions/database"
+	"lions/session"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// VoteHandler casts the logged in user's vote in the poll of the post in
+// post_id for the options in option, and goes back to the poll.
+func VoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	postID := r.FormValue("post_id")
+
+	// Locked and archived threads don't accept new votes either
+	err := database.CheckPostOpen(postID)
+	if err == database.ErrPostClosed {
+		http.Error(w, "This thread is locked and no longer accepts votes", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	seen := map[int]bool{}
+	var optionIDs []int
+	for _, value := range r.Form["option"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid option", http.StatusBadRequest)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			optionIDs = append(optionIDs, id)
+		}
+	}
+
+	err = Vote(userID, postID, optionIDs)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		http.Error(w, "This post has no poll", http.StatusNotFound)
+		return
+	case ErrClosed:
+		http.Error(w, "This poll is closed", http.StatusForbidden)
+		return
+	case ErrAlreadyVoted:
+		http.Error(w, "You have already voted in this poll", http.StatusConflict)
+		return
+	case ErrInvalidChoice:
+		http.Error(w, "Choose one of the poll's options", http.StatusBadRequest)
+		return
+	default:
+		log.Printf("Error voting in poll of post %s for user %d: %v", postID, userID, err)
+		http.Error(w, "Could not save your vote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/post/view?id="+url.QueryEscape(postID)+"#poll", http.StatusSeeOther)
+}
@@ -0,0 +1,253 @@
+// poll.go
+package poll
+
+import (
+	"database/sql"
+	"errors"
+	"lions/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Limits on the options of a poll.
+const (
+	MinOptions = 2
+	MaxOptions = 10
+)
+
+// closesAtLayout is the format of datetime-local form inputs. Times are read
+// in the server's time zone.
+const closesAtLayout = "2006-01-02T15:04"
+
+var (
+	ErrClosed        = errors.New("poll is closed")
+	ErrAlreadyVoted  = errors.New("user has already voted")
+	ErrInvalidChoice = errors.New("invalid choice")
+)
+
+// Poll is a poll attached to a post, as seen by one user.
+type Poll struct {
+	PostID            string
+	Question          string
+	MultipleChoice    bool // Voters may pick more than one option
+	Anonymous         bool // Who voted for what is never shown
+	ResultsAfterClose bool // Results are hidden until the poll closes, not just until the user votes
+	ClosesAt          sql.NullTime
+	Options           []Option
+	Voters            int  // Number of users who voted
+	Voted             bool // Whether the user has voted
+	Closed            bool // Whether the close date has passed
+	ShowResults       bool // Whether the user may see the results
+}
+
+// Option is one of the choices of a poll.
+type Option struct {
+	ID      int
+	Text    string
+	Votes   int
+	Percent int      // Share of the voters who picked the option
+	Chosen  bool     // Whether the user picked it
+	VotedBy []string // Usernames of its voters, empty for anonymous polls
+}
+
+// New is a poll filled in on the new post form, before the post exists.
+type New struct {
+	Question          string
+	Options           []string
+	MultipleChoice    bool
+	Anonymous         bool
+	ResultsAfterClose bool
+	ClosesAt          time.Time // Zero when the poll stays open
+}
+
+// FromForm reads the poll fields of the new post form. It returns nil when
+// no poll question was given.
+func FromForm(r *http.Request) (*New, error) {
+	question := strings.TrimSpace(r.FormValue("poll_question"))
+	if question == "" {
+		return nil, nil
+	}
+
+	p := &New{
+		Question:          question,
+		MultipleChoice:    r.FormValue("poll_multiple") != "",
+		Anonymous:         r.FormValue("poll_anonymous") != "",
+		ResultsAfterClose: r.FormValue("poll_results") == "closed",
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(r.FormValue("poll_options"), "\n") {
+		option := strings.TrimSpace(line)
+		if option == "" || seen[strings.ToLower(option)] {
+			continue
+		}
+		seen[strings.ToLower(option)] = true
+		p.Options = append(p.Options, option)
+	}
+	if len(p.Options) < MinOptions || len(p.Options) > MaxOptions {
+		return nil, errors.New("A poll needs between 2 and 10 different options")
+	}
+
+	if value := strings.TrimSpace(r.FormValue("poll_closes_at")); value != "" {
+		closesAt, err := time.ParseInLocation(closesAtLayout, value, time.Local)
+		if err != nil {
+			return nil, errors.New("Invalid poll close date")
+		}
+		if !closesAt.After(time.Now()) {
+			return nil, errors.New("The poll close date must be in the future")
+		}
+		p.ClosesAt = closesAt
+	}
+	if p.ResultsAfterClose && p.ClosesAt.IsZero() {
+		return nil, errors.New("Results can only be hidden until the poll closes if it has a close date")
+	}
+	return p, nil
+}
+
+// CreateTx attaches the poll p to the post postID within tx.
+func CreateTx(tx *sql.Tx, postID string, p *New) error {
+	var closesAt interface{}
+	if !p.ClosesAt.IsZero() {
+		closesAt = p.ClosesAt.UTC()
+	}
+	_, err := tx.Exec(`
+        INSERT INTO Poll (PostID, Question, MultipleChoice, Anonymous, ResultsAfterClose, ClosesAt, CreatedAt)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		postID, p.Question, p.MultipleChoice, p.Anonymous, p.ResultsAfterClose, closesAt, time.Now())
+	if err != nil {
+		return err
+	}
+	for i, option := range p.Options {
+		_, err = tx.Exec(`INSERT INTO PollOption (PostID, Text, Position) VALUES (?, ?, ?)`, postID, option, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the poll of the post postID as seen by userID (0 for visitors),
+// or nil when the post has no poll.
+func Get(postID string, userID int) (*Poll, error) {
+	p := Poll{PostID: postID}
+	err := database.DB.QueryRow(`
+        SELECT Question, MultipleChoice, Anonymous, ResultsAfterClose, ClosesAt,
+               (SELECT COUNT(DISTINCT UserID) FROM PollVote WHERE PostID = Poll.PostID),
+               EXISTS(SELECT 1 FROM PollVote WHERE PostID = Poll.PostID AND UserID = ?)
+        FROM Poll WHERE PostID = ?`, userID, postID).Scan(
+		&p.Question, &p.MultipleChoice, &p.Anonymous, &p.ResultsAfterClose, &p.ClosesAt, &p.Voters, &p.Voted)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Closed = p.ClosesAt.Valid && !p.ClosesAt.Time.After(time.Now())
+	p.ShowResults = p.Closed || (p.Voted && !p.ResultsAfterClose)
+
+	rows, err := database.DB.Query(`
+        SELECT o.OptionID, o.Text,
+               (SELECT COUNT(*) FROM PollVote WHERE OptionID = o.OptionID),
+               EXISTS(SELECT 1 FROM PollVote WHERE OptionID = o.OptionID AND UserID = ?)
+        FROM PollOption o
+        WHERE o.PostID = ?
+        ORDER BY o.Position, o.OptionID`, userID, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := map[int]int{}
+	for rows.Next() {
+		var o Option
+		if err := rows.Scan(&o.ID, &o.Text, &o.Votes, &o.Chosen); err != nil {
+			return nil, err
+		}
+		if p.Voters > 0 {
+			o.Percent = o.Votes * 100 / p.Voters
+		}
+		byID[o.ID] = len(p.Options)
+		p.Options = append(p.Options, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if p.Anonymous || !p.ShowResults {
+		return &p, nil
+	}
+	voters, err := database.DB.Query(`
+        SELECT v.OptionID, COALESCE(u.Username, '')
+        FROM PollVote v
+        LEFT JOIN User u ON v.UserID = u.UserID
+        WHERE v.PostID = ?
+        ORDER BY v.CreatedAt`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer voters.Close()
+	for voters.Next() {
+		var optionID int
+		var username string
+		if err := voters.Scan(&optionID, &username); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[optionID]; ok && username != "" {
+			p.Options[i].VotedBy = append(p.Options[i].VotedBy, username)
+		}
+	}
+	return &p, voters.Err()
+}
+
+// Vote casts the ballot of userID in the poll of the post postID. A user votes
+// once per poll, for a single option unless the poll is multiple choice.
+func Vote(userID int, postID string, optionIDs []int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var multipleChoice bool
+	var closesAt sql.NullTime
+	err = tx.QueryRow(`SELECT MultipleChoice, ClosesAt FROM Poll WHERE PostID = ?`, postID).Scan(&multipleChoice, &closesAt)
+	if err != nil {
+		return err
+	}
+	if closesAt.Valid && !closesAt.Time.After(time.Now()) {
+		return ErrClosed
+	}
+	if len(optionIDs) == 0 || (!multipleChoice && len(optionIDs) > 1) {
+		return ErrInvalidChoice
+	}
+
+	// The ballot's primary key is what keeps a user from voting twice, even
+	// with two requests at once
+	now := time.Now()
+	_, err = tx.Exec(`INSERT INTO PollBallot (UserID, PostID, CreatedAt) VALUES (?, ?, ?)`, userID, postID, now)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+		return ErrAlreadyVoted
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, optionID := range optionIDs {
+		result, err := tx.Exec(`
+            INSERT OR IGNORE INTO PollVote (UserID, PostID, OptionID, CreatedAt)
+            SELECT ?, PostID, OptionID, ? FROM PollOption WHERE OptionID = ? AND PostID = ?`,
+			userID, now, optionID, postID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrInvalidChoice
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,260 @@
+// categories.go
+package post
+
+import (
+	"database/sql"
+	"html/template"
+	"lions/category"
+	"lions/database"
+	"lions/mention"
+	"lions/session"
+	"lions/watch"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CategorySummary holds a category together with its activity statistics.
+type CategorySummary struct {
+	Category     category.Category
+	Threads      int    // Number of posts in the category
+	Replies      int    // Number of comments on those posts
+	LatestPost   *Post  // Most recently created post, nil if the category is empty
+	LastActivity string // Formatted date of the latest post or comment
+}
+
+// CategoryIndexData holds data for rendering the category index page.
+type CategoryIndexData struct {
+	Authenticated bool
+	Username      string
+	Categories    []CategorySummary
+}
+
+// CategoryPostsData holds data for rendering the posts of a single category.
+type CategoryPostsData struct {
+	Authenticated bool
+	Username      string
+	Category      category.Category
+	Posts         []Post
+	Pagination    Pagination
+	Watching      bool // Whether the user watches the category
+}
+
+// CategoryIndexHandler shows every category with its thread and reply counts,
+// latest post and last activity.
+func CategoryIndexHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := category.List(false)
+	if err != nil {
+		http.Error(w, "Could not retrieve categories", http.StatusInternalServerError)
+		log.Printf("Error retrieving categories: %v", err)
+		return
+	}
+
+	var summaries []CategorySummary
+	for _, c := range categories {
+		summary, err := summarizeCategory(c)
+		if err != nil {
+			http.Error(w, "Could not retrieve category statistics", http.StatusInternalServerError)
+			log.Printf("Error retrieving statistics for category %d: %v", c.ID, err)
+			return
+		}
+		summaries = append(summaries, summary)
+	}
+
+	data := CategoryIndexData{
+		Authenticated: r.Context().Value(session.Authenticated).(bool),
+		Username:      r.Context().Value(session.Username).(string),
+		Categories:    summaries,
+	}
+
+	tmpl, err := template.New("categories.html").Funcs(template.FuncMap{
+		"profileURL": mention.ProfileURL,
+	}).ParseFiles("static/html/categories.html")
+	if err != nil {
+		http.Error(w, "Template parsing error", http.StatusInternalServerError)
+		log.Printf("Error details: %v", err)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		log.Printf("Error details: %v", err)
+	}
+}
+
+// CategoryPostsHandler shows a paginated list of the posts in the category
+// named by the slug in /c/{slug}.
+func CategoryPostsHandler(w http.ResponseWriter, r *http.Request) {
+	slug := strings.Trim(strings.TrimPrefix(r.URL.Path, "/c/"), "/")
+	if slug == "" {
+		http.Redirect(w, r, "/categories", http.StatusSeeOther)
+		return
+	}
+
+	postCategory, err := category.GetBySlug(slug)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not retrieve category", http.StatusInternalServerError)
+		log.Printf("Error retrieving category %q: %v", slug, err)
+		return
+	}
+
+	// Extract page number from query parameters
+	currentPage, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || currentPage < 1 {
+		currentPage = 1
+	}
+	postsPerPage := 10
+	offset := (currentPage - 1) * postsPerPage
+
+	var totalPosts int
+	err = database.DB.QueryRow(`SELECT COUNT(*) FROM Post WHERE CategoryID = ? AND PublishAt IS NULL`, postCategory.ID).Scan(&totalPosts)
+	if err != nil {
+		http.Error(w, "Could not retrieve total post count", http.StatusInternalServerError)
+		log.Printf("Error retrieving total post count: %v", err)
+		return
+	}
+
+	posts, err := queryPosts(`p.CategoryID = ?`, []interface{}{postCategory.ID}, postsPerPage, offset)
+	if err != nil {
+		http.Error(w, "Could not retrieve posts", http.StatusInternalServerError)
+		log.Printf("Error retrieving posts: %v", err)
+		return
+	}
+
+	addReadState(r, posts)
+
+	// Opening a watched category marks its new threads as seen
+	var watching bool
+	if userID, _ := r.Context().Value(session.UserID).(int); userID != 0 {
+		watching, err = watch.WatchingCategory(userID, postCategory.ID)
+		if err != nil {
+			log.Printf("Error checking watch on category %d: %v", postCategory.ID, err)
+		}
+		if watching {
+			if err := watch.VisitCategory(userID, postCategory.ID); err != nil {
+				log.Printf("Error recording visit to category %d: %v", postCategory.ID, err)
+			}
+		}
+	}
+
+	data := CategoryPostsData{
+		Authenticated: r.Context().Value(session.Authenticated).(bool),
+		Username:      r.Context().Value(session.Username).(string),
+		Category:      postCategory,
+		Posts:         posts,
+		Pagination: Pagination{
+			CurrentPage: currentPage,
+			TotalPages:  (totalPosts + postsPerPage - 1) / postsPerPage,
+			PageSize:    postsPerPage,
+		},
+		Watching: watching,
+	}
+
+	tmpl, err := template.New("category_posts.html").Funcs(template.FuncMap{
+		"profileURL": mention.ProfileURL,
+		"add":        add,
+		"sub":        sub,
+	}).ParseFiles("static/html/category_posts.html")
+	if err != nil {
+		http.Error(w, "Template parsing error", http.StatusInternalServerError)
+		log.Printf("Error details: %v", err)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		log.Printf("Error details: %v", err)
+	}
+}
+
+// queryPosts returns one page of the published posts matching the given WHERE
+// condition, pinned posts first and then newest first.
+func queryPosts(condition string, args []interface{}, limit, offset int) ([]Post, error) {
+	args = append(args, limit, offset)
+	rows, err := database.DB.Query(`
+        SELECT p.PostID, p.Title, p.UserID, COALESCE(u.Username, ''), COALESCE(c.CategoryName, ''),
+               p.LastReplyUser, p.LastReplyDate, p.CreatedAt,
+               p.Pinned, p.Locked, p.Archived, p.LikesCount, p.DislikesCount,
+               (SELECT COUNT(*) FROM Comment WHERE Comment.PostID = p.PostID) AS RepliesCount
+        FROM Post p
+        LEFT JOIN User u ON p.UserID = u.UserID
+        LEFT JOIN Category c ON p.CategoryID = c.CategoryID
+        WHERE p.PublishAt IS NULL AND (`+condition+`)
+        ORDER BY p.Pinned DESC, p.CreatedAt DESC
+        LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		var userID sql.NullInt64
+		err := rows.Scan(&post.ID, &post.Title, &userID, &post.Username, &post.Category,
+			&post.LastReplyUser, &post.LastReplyDate, &post.CreatedAt,
+			&post.Pinned, &post.Locked, &post.Archived, &post.Likes, &post.Dislikes, &post.RepliesCount)
+		if err != nil {
+			return nil, err
+		}
+		post.UserID = int(userID.Int64)
+		post.CreatedAtFormatted = post.CreatedAt.Format("January 2, 2006, 3:04 PM")
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// summarizeCategory collects the thread and reply counts, latest post and last
+// activity of a category.
+func summarizeCategory(c category.Category) (CategorySummary, error) {
+	summary := CategorySummary{Category: c}
+
+	err := database.DB.QueryRow(`
+        SELECT (SELECT COUNT(*) FROM Post WHERE CategoryID = ? AND PublishAt IS NULL),
+               (SELECT COUNT(*) FROM Comment cm JOIN Post p ON cm.PostID = p.PostID WHERE p.CategoryID = ? AND p.PublishAt IS NULL)`,
+		c.ID, c.ID).Scan(&summary.Threads, &summary.Replies)
+	if err != nil {
+		return summary, err
+	}
+
+	var latest Post
+	err = database.DB.QueryRow(`
+        SELECT p.PostID, p.Title, COALESCE(u.Username, ''), p.CreatedAt
+        FROM Post p
+        LEFT JOIN User u ON p.UserID = u.UserID
+        WHERE p.CategoryID = ? AND p.PublishAt IS NULL
+        ORDER BY p.CreatedAt DESC
+        LIMIT 1`, c.ID).Scan(&latest.ID, &latest.Title, &latest.Username, &latest.CreatedAt)
+	if err == sql.ErrNoRows {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, err
+	}
+	latest.CreatedAtFormatted = latest.CreatedAt.Format("January 2, 2006, 3:04 PM")
+	summary.LatestPost = &latest
+
+	// The last activity is the newer of the latest post and the latest reply
+	lastActivity := latest.CreatedAt
+	var lastReply time.Time
+	err = database.DB.QueryRow(`
+        SELECT cm.CreatedAt
+        FROM Comment cm
+        JOIN Post p ON cm.PostID = p.PostID
+        WHERE p.CategoryID = ? AND p.PublishAt IS NULL
+        ORDER BY cm.CreatedAt DESC
+        LIMIT 1`, c.ID).Scan(&lastReply)
+	if err != nil && err != sql.ErrNoRows {
+		return summary, err
+	}
+	if lastReply.After(lastActivity) {
+		lastActivity = lastReply
+	}
+	summary.LastActivity = lastActivity.Format("January 2, 2006, 3:04 PM")
+
+	return summary, nil
+}
@@ -0,0 +1,49 @@
+// drafts.go
+package post
+
+import (
+	"database/sql"
+	"lions/draft"
+	"lions/session"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// createFormDraft returns the draft to fill the new post form with: the one
+// in the draft query parameter, or else the user's latest new post draft.
+// "new" asks for an empty form.
+func createFormDraft(r *http.Request) draft.Draft {
+	userID, _ := r.Context().Value(session.UserID).(int)
+	param := r.URL.Query().Get("draft")
+	if userID == 0 || param == "new" {
+		return draft.Draft{}
+	}
+
+	var d draft.Draft
+	var err error
+	if draftID, convErr := strconv.Atoi(param); convErr == nil {
+		d, err = draft.Get(userID, draftID)
+	} else {
+		d, err = draft.Latest(userID)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching draft for user %d: %v", userID, err)
+	}
+	if d.IsReply() {
+		return draft.Draft{}
+	}
+	return d
+}
+
+// deleteSentDraft removes the draft in the draft_id form field once the post
+// or reply written in it has been sent.
+func deleteSentDraft(r *http.Request, userID int) {
+	draftID, err := strconv.Atoi(r.FormValue("draft_id"))
+	if err != nil {
+		return
+	}
+	if err := draft.Delete(userID, draftID); err != nil {
+		log.Printf("Error deleting sent draft %d of user %d: %v", draftID, userID, err)
+	}
+}
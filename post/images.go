@@ -0,0 +1,228 @@
+// images.go
+package post
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"lions/upload"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxReplyImages is how many images a reply can have, fewer than a post.
+const maxReplyImages = 4
+
+// maxPostFormSize and maxReplyFormSize cap the whole new post and reply
+// forms: the text fields plus the largest allowed set of images.
+const (
+	maxPostFormSize  = upload.MaxImages*upload.MaxImageSize + 1<<20
+	maxReplyFormSize = maxReplyImages*upload.MaxImageSize + 1<<20
+)
+
+// CommentImage is an image attached to a reply.
+type CommentImage struct {
+	PostImage
+	CommentID string // ID of the reply the image belongs to
+}
+
+// parseImages validates the images attached to a form, before the post or
+// reply is saved, so a bad file rejects it as a whole. limit is how many
+// images may be added.
+func parseImages(r *http.Request, limit int) ([]*upload.Image, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+	files := r.MultipartForm.File["images"]
+	if len(files) > limit {
+		return nil, fmt.Errorf("At most %d images can be added", limit)
+	}
+
+	var images []*upload.Image
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("Error retrieving %s", header.Filename)
+		}
+		img, err := upload.Process(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Filename, err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// storedImage is an uploaded image whose files have been stored.
+type storedImage struct {
+	*upload.Image
+	ImagePath, ThumbnailPath string
+}
+
+// storeImages stores the files of new post images ahead of the transaction
+// that saves the post, under the caller's upload.Hold. When one fails, the
+// files stored so far are returned with the error for the caller to remove.
+func storeImages(images []*upload.Image) ([]storedImage, error) {
+	var stored []storedImage
+	for _, img := range images {
+		imagePath, thumbnailPath, err := upload.Save(img)
+		stored = append(stored, storedImage{Image: img, ImagePath: imagePath, ThumbnailPath: thumbnailPath})
+		if err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
+
+// storedFiles returns the paths of the files of stored images.
+func storedFiles(stored []storedImage) []string {
+	var paths []string
+	for _, img := range stored {
+		paths = append(paths, img.ImagePath, img.ThumbnailPath)
+	}
+	return paths
+}
+
+// insertPostImagesTx records stored images as the images of a post, in the
+// order they were uploaded.
+func insertPostImagesTx(tx *sql.Tx, postID string, userID int, stored []storedImage) error {
+	for i, img := range stored {
+		_, err := tx.Exec(`
+            INSERT INTO PostImage (ID, PostID, UserID, ImagePath, ThumbnailPath, ContentType, Position, CreatedAt)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(), postID, userID, img.ImagePath, img.ThumbnailPath, img.ContentType, i, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postImages returns the images of a post in the order they were uploaded.
+func postImages(postID string) ([]PostImage, error) {
+	rows, err := database.DB.Query(`
+        SELECT ID, PostID, UserID, ImagePath, COALESCE(ThumbnailPath, ImagePath), COALESCE(ContentType, ''), Position, CreatedAt
+        FROM PostImage
+        WHERE PostID = ?
+        ORDER BY Position, CreatedAt`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []PostImage
+	for rows.Next() {
+		var img PostImage
+		if err := rows.Scan(&img.ID, &img.PostID, &img.UserID, &img.ImagePath, &img.ThumbnailPath, &img.ContentType, &img.Position, &img.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// saveCommentImages stores images added to a reply, after the ones it
+// already has.
+func saveCommentImages(commentID, postID string, userID int, images []*upload.Image) (err error) {
+	var position int
+	err = database.DB.QueryRow(`SELECT COALESCE(MAX(Position) + 1, 0) FROM CommentImage WHERE CommentID = ?`, commentID).Scan(&position)
+	if err != nil {
+		return err
+	}
+
+	// The files of an image that could not be saved are removed once the
+	// hold is released
+	var unsaved []string
+	release := upload.Hold()
+	defer func() {
+		release()
+		upload.RemoveUnused(unsaved)
+	}()
+
+	for i, img := range images {
+		imagePath, thumbnailPath, err := upload.Save(img)
+		if err != nil {
+			unsaved = []string{imagePath, thumbnailPath}
+			return err
+		}
+		_, err = database.DB.Exec(`
+            INSERT INTO CommentImage (ID, CommentID, PostID, UserID, ImagePath, ThumbnailPath, ContentType, Position, CreatedAt)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(), commentID, postID, userID, imagePath, thumbnailPath, img.ContentType, position+i, time.Now())
+		if err != nil {
+			unsaved = []string{imagePath, thumbnailPath}
+			return err
+		}
+	}
+	return nil
+}
+
+// commentImages returns the images of every reply in a post, by reply ID.
+func commentImages(postID string) (map[string][]CommentImage, error) {
+	rows, err := database.DB.Query(`
+        SELECT ID, CommentID, PostID, UserID, ImagePath, ThumbnailPath, ContentType, Position, CreatedAt
+        FROM CommentImage
+        WHERE PostID = ?
+        ORDER BY CommentID, Position`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := map[string][]CommentImage{}
+	for rows.Next() {
+		var img CommentImage
+		if err := rows.Scan(&img.ID, &img.CommentID, &img.PostID, &img.UserID, &img.ImagePath, &img.ThumbnailPath, &img.ContentType, &img.Position, &img.CreatedAt); err != nil {
+			return nil, err
+		}
+		images[img.CommentID] = append(images[img.CommentID], img)
+	}
+	return images, rows.Err()
+}
+
+// deleteCommentImages removes the given images from a reply and deletes
+// their files unless another post or reply uses them too.
+func deleteCommentImages(commentID string, imageIDs []string) error {
+	var paths []string
+	for _, id := range imageIDs {
+		var imagePath, thumbnailPath string
+		err := database.DB.QueryRow(`SELECT ImagePath, ThumbnailPath FROM CommentImage WHERE ID = ? AND CommentID = ?`,
+			id, commentID).Scan(&imagePath, &thumbnailPath)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := database.DB.Exec(`DELETE FROM CommentImage WHERE ID = ?`, id); err != nil {
+			return err
+		}
+		paths = append(paths, imagePath, thumbnailPath)
+	}
+	upload.RemoveUnused(paths)
+	return nil
+}
+
+// imageFiles returns the stored files of the images and thumbnails of a post
+// and its replies, so they can be removed once the post is deleted.
+func imageFiles(postID string) []string {
+	rows, err := database.DB.Query(`
+        SELECT ImagePath, COALESCE(ThumbnailPath, '') FROM PostImage WHERE PostID = ?
+        UNION
+        SELECT ImagePath, ThumbnailPath FROM CommentImage WHERE PostID = ?`, postID, postID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var paths []string
+	for rows.Next() {
+		var imagePath, thumbnailPath string
+		if rows.Scan(&imagePath, &thumbnailPath) == nil {
+			paths = append(paths, imagePath, thumbnailPath)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,33 @@
+// mentions.go
+package post
+
+import (
+	"database/sql"
+	"lions/database"
+	"lions/mention"
+	"log"
+)
+
+// recordMentions stores the @mentions in the text of a post (commentID empty)
+// or comment and returns the users mentioned for the first time. Failures are
+// logged but don't stop the post or comment from being saved.
+func recordMentions(postID, commentID, text string) []mention.User {
+	var authorID sql.NullInt64
+	var err error
+	if commentID == "" {
+		err = database.DB.QueryRow(`SELECT UserID FROM Post WHERE PostID = ?`, postID).Scan(&authorID)
+	} else {
+		err = database.DB.QueryRow(`SELECT UserID FROM Comment WHERE CommentID = ?`, commentID).Scan(&authorID)
+	}
+	if err != nil {
+		log.Printf("Error fetching author for mentions in post %s comment %q: %v", postID, commentID, err)
+		return nil
+	}
+
+	added, err := mention.Record(postID, commentID, int(authorID.Int64), text)
+	if err != nil {
+		log.Printf("Error recording mentions in post %s comment %q: %v", postID, commentID, err)
+		return nil
+	}
+	return added
+}
@@ -0,0 +1,90 @@
+// notify.go
+package post
+
+import (
+	"database/sql"
+	"lions/category"
+	"lions/database"
+	"lions/mention"
+	"lions/notification"
+	"lions/watch"
+	"log"
+)
+
+// notifyReply tells the author of the parent comment, the author of the post,
+// everyone newly mentioned and everyone watching the thread about a new reply.
+// Each user gets at most one notification for the reply.
+func notifyReply(actorID int, postID, commentID, parentID string, mentioned []mention.User) {
+	notified := map[int]bool{actorID: true}
+
+	if parentID != "" {
+		var parentAuthor sql.NullInt64
+		err := database.DB.QueryRow(`SELECT UserID FROM Comment WHERE CommentID = ?`, parentID).Scan(&parentAuthor)
+		if err != nil {
+			log.Printf("Error fetching author of comment %s: %v", parentID, err)
+		} else if id := int(parentAuthor.Int64); !notified[id] {
+			notification.Send(id, actorID, notification.TypeReplyToComment, postID, commentID, "")
+			notified[id] = true
+		}
+	}
+
+	var postAuthor sql.NullInt64
+	err := database.DB.QueryRow(`SELECT UserID FROM Post WHERE PostID = ?`, postID).Scan(&postAuthor)
+	if err != nil {
+		log.Printf("Error fetching author of post %s: %v", postID, err)
+	} else if id := int(postAuthor.Int64); !notified[id] {
+		notification.Send(id, actorID, notification.TypeReplyToPost, postID, commentID, "")
+		notified[id] = true
+	}
+
+	for _, user := range mentioned {
+		if !notified[user.ID] {
+			notification.Send(user.ID, actorID, notification.TypeMention, postID, commentID, "")
+			notified[user.ID] = true
+		}
+	}
+
+	watchers, err := watch.PostWatchers(postID)
+	if err != nil {
+		log.Printf("Error fetching watchers of post %s: %v", postID, err)
+	}
+	for _, id := range watchers {
+		if !notified[id] {
+			notification.Send(id, actorID, notification.TypeWatchedThread, postID, commentID, "")
+			notified[id] = true
+		}
+	}
+}
+
+// notifyNewThread tells everyone watching a category, except users already
+// notified about a mention in the post, about a new thread in it.
+func notifyNewThread(actorID int, postID string, postCategory category.Category, mentioned []mention.User) {
+	notified := map[int]bool{actorID: true}
+	for _, user := range mentioned {
+		notified[user.ID] = true
+	}
+
+	watchers, err := watch.CategoryWatchers(postCategory.ID)
+	if err != nil {
+		log.Printf("Error fetching watchers of category %d: %v", postCategory.ID, err)
+	}
+	for _, id := range watchers {
+		if !notified[id] {
+			notification.Send(id, actorID, notification.TypeWatchedCategory, postID, "", postCategory.Name)
+		}
+	}
+}
+
+// autoWatch makes a user watch a thread they started or replied to.
+func autoWatch(userID int, postID string) {
+	if err := watch.WatchPost(userID, postID); err != nil {
+		log.Printf("Error watching post %s for user %d: %v", postID, userID, err)
+	}
+}
+
+// notifyMentions tells newly mentioned users about a post or comment.
+func notifyMentions(actorID int, postID, commentID string, mentioned []mention.User) {
+	for _, user := range mentioned {
+		notification.Send(user.ID, actorID, notification.TypeMention, postID, commentID, "")
+	}
+}
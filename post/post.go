@@ -4,20 +4,24 @@ package post
 import (
 	"database/sql"
 	"fmt"
+	"html/template"
+	"lions/category"
 	"lions/database"
+	"lions/draft"
+	"lions/mention"
+	"lions/poll"
+	"lions/readmark"
+	"lions/reputation"
 	"lions/session"
+	"lions/tag"
+	"lions/upload"
+	"lions/watch"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
-
-	"github.com/google/uuid"
-
-	"io"
-	"os"
 )
 
 // Post represents a blog post with various details.
@@ -40,6 +44,18 @@ type Post struct {
 	CreatedAt          time.Time
 	Images             []PostImage
 	CreatedAtFormatted string // Formatted creation date
+	Pinned             bool   // Pinned posts are listed first
+	Locked             bool   // Locked posts accept no new replies or likes
+	Archived           bool   // Archived posts are read-only
+	Tags               []string
+	New                bool         // The user has never opened the post
+	Unread             int          // Replies the user hasn't read
+	FirstUnread        int          // ID of the oldest unread reply
+	Book               string       // Book the post discusses
+	SpoilerChapter     int          // Last chapter of Book the post spoils, 0 for none
+	PublishAt          sql.NullTime // When a scheduled post goes live, unset once published
+	AvatarPath         string       // Stored path of the author's avatar, empty for the default one
+	Reputation         int          // Reputation of the author
 }
 
 type Category struct {
@@ -65,7 +81,8 @@ type PageData struct {
 	CurrentPage   int
 	TotalPages    int
 	Filter        FilterParams
-	Categories    []Category
+	Categories    []category.Category // Categories for the create and filter forms
+	Draft         draft.Draft         // Draft the create form is filled with
 }
 
 type FilterParams struct {
@@ -74,6 +91,8 @@ type FilterParams struct {
 	LikesOrder    string
 	RepliesOrder  string
 	DislikesOrder string
+	Tags          string // Comma-separated tag names
+	TagMode       string // "all" to require every tag, "any" to match at least one
 }
 
 // Reply represents a reply to a post with user information.
@@ -83,6 +102,8 @@ type Reply struct {
 	Username   string
 	CreatedAt  time.Time
 	TaggedUser string
+	AvatarPath string // Stored path of the author's avatar, empty for the default one
+	Reputation int    // Reputation of the author
 }
 
 type FormattedReply struct {
@@ -91,27 +112,51 @@ type FormattedReply struct {
 	LikesCount         int
 	DislikesCount      int
 	TaggedUser         string
+	ParentID           string            // ID of the reply this one answers, empty for replies to the post
+	ParentUsername     string            // Author of the parent reply
+	Depth              int               // Nesting level in the thread, 0 for replies to the post
+	Children           []*FormattedReply // Replies to this reply
+	Unread             bool              // Whether the user hasn't read the reply yet
+	QuotedID           string            // ID of the reply this one quotes, empty when it quotes none
+	QuotedUsername     string            // Author of the quoted reply
+	QuoteEdited        bool              // The quoted reply was edited after it was quoted
+	QuoteDeleted       bool              // The quoted reply no longer exists
+	Images             []CommentImage    // Images attached to the reply
 }
 
 // PostViewData holds data for rendering a single post with its replies.
 type PostViewData struct {
 	Post                   Post
-	Replies                []FormattedReply
+	Replies                []*FormattedReply // Top-level replies, each holding its own replies
+	ReplyOrder             string            // "oldest", "newest" or "top"
 	Authenticated          bool
 	Username               string
 	FormattedCreatedAt     string
 	LastReplyDateFormatted string
 	SameUser               bool
-	Users                  []string
+	IsModerator            bool
+	Categories             []category.Category // Categories a moderator can move the post to
+	Watching               bool                // Whether the user watches the thread
+	Unread                 int                 // Replies the user hadn't read before opening the post
+	FirstUnread            int                 // ID of the oldest of those replies
+	SpoilerHidden          bool                // Whether the thread spoils chapters the user hasn't read
+	ReadChapter            int                 // Chapter of the post's book the user has read up to
+	Quote                  string              // Quote the reply form is pre-filled with
+	QuotedID               string              // ID of the reply being quoted
+	Draft                  draft.Draft         // The user's unsent reply in the thread
+	Poll                   *poll.Poll          // Poll attached to the post, nil when there is none
 }
 
 // PostImage represents an image associated with a blog post.
 type PostImage struct {
-	ID        string       // Unique identifier for the post image
-	PostID    string       // ID of the associated post
-	UserID    int          // ID of the user who uploaded the image
-	ImagePath string       // Path to the image file
-	CreatedAt sql.NullTime // Timestamp when the image was uploaded
+	ID            string       // Unique identifier for the post image
+	PostID        string       // ID of the associated post
+	UserID        int          // ID of the user who uploaded the image
+	ImagePath     string       // Path to the image file
+	ThumbnailPath string       // Path to the scaled-down copy shown in the post
+	ContentType   string       // Sniffed MIME type of the image
+	Position      int          // Order of the image in the post
+	CreatedAt     sql.NullTime // Timestamp when the image was uploaded
 }
 
 // ImageData holds data for rendering the image upload page.
@@ -133,25 +178,42 @@ func sub(a, b int) int {
 
 func CreatePost(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxPostFormSize)
 		err := r.ParseMultipartForm(10 << 20) // 10 MB
 		if err != nil {
-			http.Error(w, "Unable to parse form", http.StatusBadRequest)
+			http.Error(w, "Unable to parse form, the images may be too large", http.StatusBadRequest)
 			return
 		}
 
 		title := r.FormValue("title")
 		content := r.FormValue("content")
-		category := r.FormValue("category")
-		file, handler, err := r.FormFile("image")
-		if err != nil && err != http.ErrMissingFile {
-			http.Error(w, "Error retrieving the file", http.StatusBadRequest)
+		categoryName := r.FormValue("category")
+		images, err := parseImages(r, upload.MaxImages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if title == "" || content == "" || category == "" {
+		if title == "" || content == "" || categoryName == "" {
 			http.Error(w, "All fields are required", http.StatusBadRequest)
 			return
 		}
+		book, spoilerChapter, err := parseSpoilerFields(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		publishAt, err := parsePublishAt(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scheduled := !publishAt.IsZero()
+		newPoll, err := poll.FromForm(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		authenticated := r.Context().Value(session.Authenticated).(bool)
 		username := r.Context().Value(session.Username).(string)
@@ -167,78 +229,54 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var categoryID int
-		err = database.DB.QueryRow(`SELECT CategoryID FROM Category WHERE CategoryName = ?`, category).Scan(&categoryID)
-		if err != nil && err != sql.ErrNoRows {
+		// Posts can only go into existing categories that are not archived
+		postCategory, err := category.GetByName(categoryName)
+		if err == sql.ErrNoRows || (err == nil && postCategory.Archived) {
+			http.Error(w, "Unknown category", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
 			http.Error(w, "Could not find category", http.StatusInternalServerError)
 			return
 		}
 
-		if err == sql.ErrNoRows {
-			result, err := database.DB.Exec(`INSERT INTO Category (CategoryName) VALUES (?)`, category)
-			if err != nil {
-				http.Error(w, "Could not create category", http.StatusInternalServerError)
-				return
-			}
-			categoryID64, err := result.LastInsertId()
-			if err != nil {
-				http.Error(w, "Could not retrieve category ID", http.StatusInternalServerError)
-				return
-			}
-			categoryID = int(categoryID64)
+		// The image files are stored first; the post and everything attached
+		// to it are then saved together, and nobody is notified until that
+		// has succeeded. Unused files are only removed after the hold is
+		// released, so the files can't go away before the post refers to them
+		release := upload.Hold()
+		stored, err := storeImages(images)
+		if err != nil {
+			release()
+			upload.RemoveUnused(storedFiles(stored))
+			log.Printf("Error storing images for a new post: %v", err)
+			http.Error(w, "Unable to save the images", http.StatusInternalServerError)
+			return
 		}
-
-		_, err = database.DB.Exec(`INSERT INTO Post (Title, Content, UserID, CategoryID, CreatedAt) VALUES (?, ?, ?, ?, ?)`,
-			title, content, userID, categoryID, time.Now().Format(time.RFC3339))
+		postID, err := createPost(userID, postCategory.ID, title, content, book, spoilerChapter, publishAt,
+			tag.ParseList(r.FormValue("tags")), newPoll, stored)
+		release()
 		if err != nil {
+			upload.RemoveUnused(storedFiles(stored))
 			log.Printf("Error creating post: %v", err)
 			http.Error(w, "Could not create post", http.StatusInternalServerError)
 			return
 		}
 
-		if file != nil {
-			fileName := uuid.New().String() + "_" + handler.Filename
-			filePath := "uploads/" + fileName
-
-			if err := os.MkdirAll("uploads", os.ModePerm); err != nil {
-				http.Error(w, "Unable to create uploads directory", http.StatusInternalServerError)
-				return
-			}
-
-			dst, err := os.Create(filePath)
-			if err != nil {
-				log.Println("Error creating file:", err)
-				http.Error(w, "Unable to create the file", http.StatusInternalServerError)
-				return
-			}
-			defer dst.Close()
-
-			_, err = io.Copy(dst, file)
-			if err != nil {
-				log.Println("Error saving file:", err)
-				http.Error(w, "Unable to save the file", http.StatusInternalServerError)
-				return
-			}
-
-			postID := r.FormValue("post_id")
-
-			postImage := PostImage{
-				ID:        uuid.New().String(),
-				PostID:    postID,
-				UserID:    userID,
-				ImagePath: filePath,
-				CreatedAt: sql.NullTime{Time: time.Now(), Valid: true},
-			}
-
-			err = savePostImageToDB(postImage)
-			if err != nil {
-				log.Println("Error saving image to database:", err)
-				http.Error(w, "Unable to save image information", http.StatusInternalServerError)
-				return
-			}
-			log.Println("Image saved to database:", postImage)
+		// Scheduled posts notify nobody until the scheduler publishes them
+		if !scheduled {
+			mentioned := recordMentions(postID, "", content)
+			notifyMentions(userID, postID, "", mentioned)
+			notifyNewThread(userID, postID, postCategory, mentioned)
 		}
+		autoWatch(userID, postID)
+		deleteSentDraft(r, userID)
 
+		// Scheduled posts aren't in the forum list yet, only in the author's own
+		if scheduled {
+			http.Redirect(w, r, "/my-posts", http.StatusSeeOther)
+			return
+		}
 		http.Redirect(w, r, "/post", http.StatusSeeOther)
 	} else {
 		tmpl, err := template.New("create_post.html").Funcs(template.FuncMap{
@@ -256,6 +294,52 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// createPost saves a new post with its tags, poll and images in one
+// transaction, so a failure leaves nothing half-created behind. The image
+// files have already been stored; the caller removes them when saving fails.
+func createPost(userID, categoryID int, title, content, book string, spoilerChapter int, publishAt time.Time,
+	tags []string, newPoll *poll.New, images []storedImage) (postID string, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var publishAtValue interface{}
+	if !publishAt.IsZero() {
+		publishAtValue = publishAt.UTC()
+	}
+	result, err := tx.Exec(`INSERT INTO Post (Title, Content, UserID, CategoryID, CreatedAt, Book, SpoilerChapter, PublishAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		title, content, userID, categoryID, time.Now().Format(time.RFC3339), book, spoilerChapter, publishAtValue)
+	if err != nil {
+		return "", err
+	}
+	newPostID, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	postID = strconv.FormatInt(newPostID, 10)
+
+	if err = tag.SetPostTagsTx(tx, postID, tags); err != nil {
+		return "", fmt.Errorf("saving tags: %w", err)
+	}
+	if newPoll != nil {
+		if err = poll.CreateTx(tx, postID, newPoll); err != nil {
+			return "", fmt.Errorf("saving poll: %w", err)
+		}
+	}
+	if err = insertPostImagesTx(tx, postID, userID, images); err != nil {
+		return "", fmt.Errorf("saving images: %w", err)
+	}
+	return postID, nil
+}
+
 func ViewPost(w http.ResponseWriter, r *http.Request) {
 	postID := r.URL.Query().Get("id")
 	if postID == "" {
@@ -268,7 +352,8 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
         SELECT p.PostID, p.Title, p.Content, p.CreatedAt, p.LastReplyDate, p.LastReplyUser, 
                u.Username, c.CategoryName, 
                (SELECT COUNT(*) FROM Comment WHERE PostID = p.PostID) AS RepliesCount,
-               p.LikesCount, p.DislikesCount
+               p.LikesCount, p.DislikesCount, p.Pinned, p.Locked, p.Archived,
+               p.UserID, p.Book, p.SpoilerChapter, p.PublishAt, COALESCE(u.AvatarPath, ''), u.Reputation
         FROM Post p
         JOIN User u ON p.UserID = u.UserID
         JOIN Category c ON p.CategoryID = c.CategoryID
@@ -284,21 +369,76 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 		&post.RepliesCount,
 		&post.Likes,
 		&post.Dislikes,
+		&post.Pinned,
+		&post.Locked,
+		&post.Archived,
+		&post.UserID,
+		&post.Book,
+		&post.SpoilerChapter,
+		&post.PublishAt,
+		&post.AvatarPath,
+		&post.Reputation,
 	)
+	if err == sql.ErrNoRows {
+		// The post may have been merged into another thread
+		var newPostID string
+		if database.DB.QueryRow(`SELECT NewPostID FROM PostRedirect WHERE OldPostID = ?`, postID).Scan(&newPostID) == nil {
+			http.Redirect(w, r, "/post/view?id="+url.QueryEscape(newPostID), http.StatusMovedPermanently)
+			return
+		}
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Error fetching post: %v", err)
 		http.Error(w, "Could not fetch post", http.StatusInternalServerError)
 		return
 	}
 
+	post.Tags, err = tag.ForPost(post.ID)
+	if err != nil {
+		log.Printf("Error fetching tags: %v", err)
+		http.Error(w, "Could not fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	// Find out what the user hasn't read yet before marking the thread as read
+	currentUsername := r.Context().Value(session.Username).(string)
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	// Until it is published a scheduled post is only shown to its author and moderators
+	if post.PublishAt.Valid && post.UserID != userID {
+		if isModerator, err := database.IsModerator(userID); err != nil || !isModerator {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	var readState readmark.State
+	if userID != 0 {
+		readState, err = readmark.Get(userID, postID)
+		if err != nil {
+			log.Printf("Error fetching read state of post %s: %v", postID, err)
+		}
+		if err := readmark.MarkRead(userID, postID); err != nil {
+			log.Printf("Error marking post %s as read: %v", postID, err)
+		}
+	}
+
 	rows, err := database.DB.Query(`
-        SELECT c.CommentID, c.Content, c.CreatedAt, u.Username, c.TaggedUser,
+        SELECT c.CommentID, c.Content, c.CreatedAt, u.Username, c.TaggedUser, COALESCE(c.ParentCommentID, ''),
                (SELECT COUNT(*) FROM CommentLikes WHERE CommentID = c.CommentID AND IsLike = 1) AS LikesCount,
-               (SELECT COUNT(*) FROM CommentLikes WHERE CommentID = c.CommentID AND IsLike = 0) AS DislikesCount
+               (SELECT COUNT(*) FROM CommentLikes WHERE CommentID = c.CommentID AND IsLike = 0) AS DislikesCount,
+               COALESCE(c.QuotedCommentID, ''), COALESCE(qu.Username, ''),
+               COALESCE(julianday(q.UpdatedAt) > julianday(c.CreatedAt), 0) AS QuoteEdited,
+               c.QuotedCommentID IS NOT NULL AND q.CommentID IS NULL AS QuoteDeleted,
+               COALESCE(u.AvatarPath, ''), u.Reputation
         FROM Comment c
         JOIN User u ON c.UserID = u.UserID
+        LEFT JOIN Comment q ON q.CommentID = c.QuotedCommentID
+        LEFT JOIN User qu ON q.UserID = qu.UserID
         WHERE c.PostID = ?
-        ORDER BY c.CreatedAt DESC`, postID)
+        ORDER BY c.CreatedAt`, postID)
 	if err != nil {
 		log.Printf("Error fetching replies: %v", err)
 		http.Error(w, "Could not fetch replies", http.StatusInternalServerError)
@@ -306,23 +446,47 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var replies []FormattedReply
+	replyImages, err := commentImages(postID)
+	if err != nil {
+		log.Printf("Error fetching reply images of post %s: %v", postID, err)
+	}
+
+	var replies []*FormattedReply
 	for rows.Next() {
 		var reply Reply
+		var parentID string
 		var likesCount, dislikesCount int
-		if err := rows.Scan(&reply.ID, &reply.Content, &reply.CreatedAt, &reply.Username, &reply.TaggedUser, &likesCount, &dislikesCount); err != nil {
+		var quotedID, quotedUsername string
+		var quoteEdited, quoteDeleted bool
+		if err := rows.Scan(&reply.ID, &reply.Content, &reply.CreatedAt, &reply.Username, &reply.TaggedUser, &parentID, &likesCount, &dislikesCount,
+			&quotedID, &quotedUsername, &quoteEdited, &quoteDeleted, &reply.AvatarPath, &reply.Reputation); err != nil {
 			log.Printf("Error scanning reply: %v", err)
 			continue
 		}
-		formattedReply := FormattedReply{
+		formattedReply := &FormattedReply{
 			Reply:              reply,
 			FormattedCreatedAt: reply.CreatedAt.Format("January 2, 2006 at 3:04pm"),
 			LikesCount:         likesCount,
 			DislikesCount:      dislikesCount,
+			ParentID:           parentID,
+			QuotedID:           quotedID,
+			QuotedUsername:     quotedUsername,
+			QuoteEdited:        quoteEdited,
+			QuoteDeleted:       quoteDeleted,
+			Images:             replyImages[reply.ID],
+		}
+		if id, _ := strconv.Atoi(reply.ID); readState.FirstUnread != 0 && id >= readState.FirstUnread && reply.Username != currentUsername {
+			formattedReply.Unread = true
 		}
 		replies = append(replies, formattedReply)
 	}
 
+	replyOrder := r.URL.Query().Get("order")
+	if !replyOrders[replyOrder] {
+		replyOrder = defaultReplyOrder
+	}
+	replies = buildReplyTree(replies, replyOrder)
+
 	var lastReplyDateFormatted string
 	if post.LastReplyDate.Valid {
 		lastReplyDateFormatted = post.LastReplyDate.Time.Format("January 2, 2006 at 3:04pm")
@@ -330,30 +494,109 @@ func ViewPost(w http.ResponseWriter, r *http.Request) {
 		lastReplyDateFormatted = "No replies yet"
 	}
 
-	currentUsername := r.Context().Value(session.Username).(string)
 	sameUser := currentUsername == post.Username
 
-	users, err := fetchUsers()
+	isModerator, err := database.IsModerator(userID)
 	if err != nil {
-		log.Printf("Error fetching users: %v", err)
-		http.Error(w, "Could not fetch users", http.StatusInternalServerError)
-		return
+		log.Printf("Error checking moderator role: %v", err)
+	}
+
+	// Opening a watched thread marks its replies as seen
+	var watching bool
+	if userID != 0 {
+		watching, err = watch.WatchingPost(userID, postID)
+		if err != nil {
+			log.Printf("Error checking watch on post %s: %v", postID, err)
+		}
+		if watching {
+			if err := watch.VisitPost(userID, postID); err != nil {
+				log.Printf("Error recording visit to post %s: %v", postID, err)
+			}
+		}
+	}
+
+	// The Quote link on a reply pre-fills the reply form with a quote of it
+	var quote, quotedID string
+	if quoteID := r.URL.Query().Get("quote"); quoteID != "" && userID != 0 {
+		quote, err = commentQuote(postID, quoteID)
+		if err != nil {
+			log.Printf("Error fetching comment %s to quote: %v", quoteID, err)
+		}
+		if quote != "" {
+			quotedID = quoteID
+		}
+	}
+
+	// An unsent reply is restored into the reply form
+	var replyDraft draft.Draft
+	if userID != 0 {
+		replyDraft, err = draft.ForPost(userID, postID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error fetching draft reply to post %s: %v", postID, err)
+		}
+	}
+
+	post.Images, err = postImages(postID)
+	if err != nil {
+		log.Printf("Error fetching images of post %s: %v", postID, err)
+	}
+
+	postPoll, err := poll.Get(postID, userID)
+	if err != nil {
+		log.Printf("Error fetching poll of post %s: %v", postID, err)
+	}
+
+	spoilerHidden, readChapter, err := spoilerGuard(post, userID)
+	if err != nil {
+		log.Printf("Error fetching reading progress of user %d: %v", userID, err)
+	}
+	// Hidden content is left out of the page entirely, until the reader asks
+	// for it with spoilers=show
+	if r.URL.Query().Get("spoilers") == "show" {
+		spoilerHidden = false
+	}
+	if spoilerHidden {
+		quote, quotedID = "", ""
+	}
+
+	var categories []category.Category
+	if isModerator {
+		categories, err = category.List(true)
+		if err != nil {
+			log.Printf("Error fetching categories: %v", err)
+		}
 	}
 
 	data := PostViewData{
 		Post:                   post,
 		Replies:                replies,
+		ReplyOrder:             replyOrder,
 		Authenticated:          r.Context().Value(session.Authenticated).(bool),
 		Username:               currentUsername,
 		FormattedCreatedAt:     post.CreatedAt.Format("January 2, 2006 at 3:04pm"),
 		LastReplyDateFormatted: lastReplyDateFormatted,
 		SameUser:               sameUser,
-		Users:                  users,
+		IsModerator:            isModerator,
+		Categories:             categories,
+		Watching:               watching,
+		Unread:                 readState.Unread,
+		FirstUnread:            readState.FirstUnread,
+		SpoilerHidden:          spoilerHidden,
+		ReadChapter:            readChapter,
+		Quote:                  quote,
+		QuotedID:               quotedID,
+		Draft:                  replyDraft,
+		Poll:                   postPoll,
 	}
 
 	tmpl, err := template.New("view_post.html").Funcs(template.FuncMap{
-		"add": add,
-		"sub": sub,
+		"add":        add,
+		"sub":        sub,
+		"render":     renderContent,
+		"profileURL": mention.ProfileURL,
+		"replyView": func(reply *FormattedReply) replyView {
+			return replyView{Page: &data, Reply: reply}
+		},
 	}).ParseFiles("static/html/view_post.html")
 	if err != nil {
 		log.Printf("Error parsing template: %v", err)
@@ -386,7 +629,7 @@ func ListPosts(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch total number of posts
 	var totalPosts int
-	err := database.DB.QueryRow("SELECT COUNT(*) FROM Post").Scan(&totalPosts)
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM Post WHERE PublishAt IS NULL").Scan(&totalPosts)
 	if err != nil {
 		http.Error(w, "Could not retrieve total post count", http.StatusInternalServerError)
 		log.Printf("Error retrieving total post count: %v", err)
@@ -396,14 +639,15 @@ func ListPosts(w http.ResponseWriter, r *http.Request) {
 	// Fetch posts for the current page along with likes, dislikes, and comments count
 	rows, err := database.DB.Query(`
         SELECT Post.PostID, Post.Title, Post.Content, Post.CategoryID, Post.UserID, Post.LastReplyUser, 
-               Post.LastReplyDate, Post.CreatedAt,
+               Post.LastReplyDate, Post.CreatedAt, Post.Pinned, Post.Locked, Post.Archived,
                COALESCE(SUM(CASE WHEN PostLikes.IsLike = 1 THEN 1 ELSE 0 END), 0) AS Likes,
                COALESCE(SUM(CASE WHEN PostLikes.IsLike = 0 THEN 1 ELSE 0 END), 0) AS Dislikes,
                COALESCE((SELECT COUNT(*) FROM Comment WHERE Comment.PostID = Post.PostID), 0) AS NumComments
         FROM Post
         LEFT JOIN PostLikes ON Post.PostID = Postlikes.PostID
+        WHERE Post.PublishAt IS NULL
         GROUP BY Post.PostID
-        ORDER BY Post.CreatedAt DESC
+        ORDER BY Post.Pinned DESC, Post.CreatedAt DESC
         LIMIT ? OFFSET ?`, postsPerPage, offset)
 	if err != nil {
 		http.Error(w, "Could not retrieve posts", http.StatusInternalServerError)
@@ -416,7 +660,7 @@ func ListPosts(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var post Post
 		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.CategoryID, &post.UserID, &post.LastReplyUser,
-			&post.LastReplyDate, &post.CreatedAt, &post.Likes, &post.Dislikes, &post.RepliesCount)
+			&post.LastReplyDate, &post.CreatedAt, &post.Pinned, &post.Locked, &post.Archived, &post.Likes, &post.Dislikes, &post.RepliesCount)
 		if err != nil {
 			http.Error(w, "Could not scan post", http.StatusInternalServerError)
 			log.Printf("Error scanning post: %v", err)
@@ -450,6 +694,7 @@ func ListPosts(w http.ResponseWriter, r *http.Request) {
 	for i, post := range posts {
 		posts[i].CreatedAtFormatted = post.CreatedAt.Format("January 2, 2006, 3:04 PM")
 	}
+	addReadState(r, posts)
 
 	// Calculate the total number of pages
 	totalPages := (totalPosts + postsPerPage - 1) / postsPerPage
@@ -464,17 +709,27 @@ func ListPosts(w http.ResponseWriter, r *http.Request) {
 	authenticated := r.Context().Value(session.Authenticated).(bool)
 	username := r.Context().Value(session.Username).(string)
 
+	categories, err := category.List(false)
+	if err != nil {
+		http.Error(w, "Could not retrieve categories", http.StatusInternalServerError)
+		log.Printf("Error retrieving categories: %v", err)
+		return
+	}
+
 	// Prepare data for rendering the template
 	data := PageData{
 		Posts:         posts,
 		Pagination:    pagination,
 		Authenticated: authenticated,
 		Username:      username,
+		Categories:    categories,
+		Draft:         createFormDraft(r),
 	}
 
 	tmpl, err := template.New("post.html").Funcs(template.FuncMap{
-		"add": add,
-		"sub": sub,
+		"profileURL": mention.ProfileURL,
+		"add":        add,
+		"sub":        sub,
 	}).ParseFiles("static/html/post.html")
 	if err != nil {
 		http.Error(w, "Template parsing error", http.StatusInternalServerError)
@@ -503,10 +758,24 @@ func AddReply(w http.ResponseWriter, r *http.Request) {
 	// Get the username from session
 	username := r.Context().Value(session.Username).(string)
 
+	// Replies with images are sent as multipart forms
+	r.Body = http.MaxBytesReader(w, r.Body, maxReplyFormSize)
+	if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Unable to parse form, the images may be too large", http.StatusBadRequest)
+		return
+	}
+	images, err := parseImages(r, maxReplyImages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get the post ID and content from the form data
 	postID := r.FormValue("postID")
 	content := r.FormValue("content")
 	taggedUser := r.FormValue("tagged_user")
+	parentID := r.FormValue("parent_id")
+	quotedID := r.FormValue("quoted_comment_id")
 
 	// Validate input
 	if postID == "" || content == "" {
@@ -514,9 +783,58 @@ func AddReply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked and archived threads don't accept new replies
+	err = database.CheckPostOpen(postID)
+	if err == database.ErrPostClosed {
+		http.Error(w, "This thread is locked and no longer accepts replies", http.StatusForbidden)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking post state for post %s: %v", postID, err)
+		http.Error(w, "Could not add reply", http.StatusInternalServerError)
+		return
+	}
+
+	// A reply to another reply has to stay within the same thread
+	var parent sql.NullString
+	if parentID != "" {
+		valid, err := validParent(postID, parentID)
+		if err != nil {
+			log.Printf("Error checking parent comment %s: %v", parentID, err)
+			http.Error(w, "Could not add reply", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			http.Error(w, "The reply you are answering does not belong to this post", http.StatusBadRequest)
+			return
+		}
+		parent = sql.NullString{String: parentID, Valid: true}
+	}
+
+	// A quote has to come from the same thread, and is only linked while the
+	// reply still contains it
+	var quoted sql.NullString
+	if quotedID != "" && strings.Contains(content, quoteLink(quotedID)) {
+		valid, err := validParent(postID, quotedID)
+		if err != nil {
+			log.Printf("Error checking quoted comment %s: %v", quotedID, err)
+			http.Error(w, "Could not add reply", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			http.Error(w, "The reply you are quoting does not belong to this post", http.StatusBadRequest)
+			return
+		}
+		quoted = sql.NullString{String: quotedID, Valid: true}
+	}
+
 	// Get the user ID
 	var userID int
-	err := database.DB.QueryRow(`SELECT UserID FROM User WHERE Username = ?`, username).Scan(&userID)
+	err = database.DB.QueryRow(`SELECT UserID FROM User WHERE Username = ?`, username).Scan(&userID)
 	if err != nil {
 		log.Printf("Error retrieving user ID for username %s: %v", username, err)
 		http.Error(w, "Could not retrieve user ID", http.StatusInternalServerError)
@@ -527,8 +845,8 @@ func AddReply(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 
 	// Insert the reply into the database
-	_, err = database.DB.Exec(`INSERT INTO Comment (PostID, UserID, Content, TaggedUser, CreatedAt) VALUES (?, ?, ?, ?, ?)`,
-		postID, userID, content, taggedUser, now)
+	result, err := database.DB.Exec(`INSERT INTO Comment (PostID, UserID, Content, TaggedUser, CreatedAt, ParentCommentID, QuotedCommentID) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		postID, userID, content, taggedUser, now, parent, quoted)
 	if err != nil {
 		log.Printf("Error inserting reply into database: %v", err)
 		http.Error(w, "Could not add reply", http.StatusInternalServerError)
@@ -544,40 +862,40 @@ func AddReply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Redirect to the post view page
+	// Redirect to the new reply on the post view page
 	redirectURL := "/post/view?id=" + url.QueryEscape(postID)
+	if commentID, err := result.LastInsertId(); err == nil {
+		if err := saveCommentImages(strconv.FormatInt(commentID, 10), postID, userID, images); err != nil {
+			log.Printf("Error saving images for reply %d: %v", commentID, err)
+			http.Error(w, "Unable to save the images", http.StatusInternalServerError)
+			return
+		}
+		mentionText := content
+		if taggedUser != "" {
+			mentionText += " @" + taggedUser
+		}
+		mentioned := recordMentions(postID, strconv.FormatInt(commentID, 10), mentionText)
+		notifyReply(userID, postID, strconv.FormatInt(commentID, 10), parentID, mentioned)
+		autoWatch(userID, postID)
+		deleteSentDraft(r, userID)
+		redirectURL += "#comment-" + strconv.FormatInt(commentID, 10)
+	}
 	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
 
 ///////////////SessionMiddleware END////////////////////
 
-func fetchUsers() ([]string, error) {
-	rows, err := database.DB.Query(`SELECT Username FROM User`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []string
-	for rows.Next() {
-		var username string
-		if err := rows.Scan(&username); err != nil {
-			return nil, err
-		}
-		users = append(users, username)
-	}
-	return users, nil
-}
-
 ///////////////Filter posts ////////////////////
 
 func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve filter, sort, and pagination parameters from query
-	category := r.URL.Query().Get("category")
+	categoryName := r.URL.Query().Get("category")
 	sortOrder := r.URL.Query().Get("sort")
 	likesOrder := r.URL.Query().Get("likes")
 	dislikesOrder := r.URL.Query().Get("dislikes")
 	repliesOrder := r.URL.Query().Get("replies")
+	tagNames := tag.ParseList(r.URL.Query().Get("tags"))
+	tagMode := r.URL.Query().Get("tag_mode")
 	pageParam := r.URL.Query().Get("page")
 	pageSizeParam := r.URL.Query().Get("pageSize")
 
@@ -604,17 +922,35 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	offset := (currentPage - 1) * pageSize
 
-	// Prepare category condition
-	var categoryCondition string
+	// Prepare category and tag conditions
+	conditions := []string{"p.PublishAt IS NULL"} // Only published posts
 	var args []interface{}
 
-	if category == "all" || category == "" {
-		categoryCondition = "1=1" // No filter
-	} else {
-		categoryCondition = "p.CategoryID = (SELECT CategoryID FROM Category WHERE CategoryName = ?)"
-		args = append(args, category)
+	if categoryName != "all" && categoryName != "" {
+		conditions = append(conditions, "p.CategoryID = (SELECT CategoryID FROM Category WHERE CategoryName = ?)")
+		args = append(args, categoryName)
 	}
 
+	if tagMode != "all" {
+		tagMode = "any"
+	}
+	if len(tagNames) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tagNames)), ", ")
+		tagCondition := "p.PostID IN (SELECT pt.PostID FROM PostTag pt JOIN Tag t ON pt.TagID = t.TagID WHERE t.Name IN (" + placeholders + ")"
+		if tagMode == "all" {
+			// Only posts having every one of the tags
+			tagCondition += " GROUP BY pt.PostID HAVING COUNT(DISTINCT pt.TagID) = ?"
+		}
+		conditions = append(conditions, tagCondition+")")
+		for _, name := range tagNames {
+			args = append(args, name)
+		}
+		if tagMode == "all" {
+			args = append(args, len(tagNames))
+		}
+	}
+	categoryCondition := strings.Join(conditions, " AND ")
+
 	// Fetch total number of posts matching the filter criteria
 	var totalPosts int
 	err := database.DB.QueryRow("SELECT COUNT(*) FROM Post p WHERE "+categoryCondition, args...).Scan(&totalPosts)
@@ -624,8 +960,8 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Construct dynamic ORDER BY clause
-	var orderByClause []string
+	// Construct dynamic ORDER BY clause, always keeping pinned posts first
+	orderByClause := []string{"p.Pinned DESC"}
 
 	if likesOrder != "" {
 		orderByClause = append(orderByClause, "l.Likes "+likesOrder)
@@ -652,7 +988,7 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
     SELECT p.PostID, p.Title, p.Content, p.UserID, p.CategoryID, 
            COALESCE(l.Likes, 0) AS Likes, 
            COALESCE(l.Dislikes, 0) AS Dislikes, 
-           p.CreatedAt,
+           p.CreatedAt, p.Pinned, p.Locked, p.Archived,
            COALESCE(c.RepliesCount, 0) AS RepliesCount
     FROM Post p
     LEFT JOIN (
@@ -686,7 +1022,7 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.CategoryID, &post.Likes, &post.Dislikes, &post.CreatedAt, &post.RepliesCount)
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.CategoryID, &post.Likes, &post.Dislikes, &post.CreatedAt, &post.Pinned, &post.Locked, &post.Archived, &post.RepliesCount)
 		if err != nil {
 			http.Error(w, "Could not scan post", http.StatusInternalServerError)
 			log.Printf("Error scanning post: %v", err)
@@ -718,6 +1054,7 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 
 		posts = append(posts, post)
 	}
+	addReadState(r, posts)
 
 	// Calculate the total number of pages
 	totalPages := (totalPosts + pageSize - 1) / pageSize
@@ -733,24 +1070,36 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 	authenticated := r.Context().Value(session.Authenticated).(bool)
 	username := r.Context().Value(session.Username).(string)
 
+	categories, err := category.List(false)
+	if err != nil {
+		http.Error(w, "Could not retrieve categories", http.StatusInternalServerError)
+		log.Printf("Error retrieving categories: %v", err)
+		return
+	}
+
 	// Prepare data for rendering the template
 	data := PageData{
 		Posts:         posts,
 		Pagination:    pagination,
 		Authenticated: authenticated,
 		Username:      username,
+		Categories:    categories,
+		Draft:         createFormDraft(r),
 		Filter: FilterParams{
-			Category:      category,
+			Category:      categoryName,
 			SortOrder:     sortOrder,
 			LikesOrder:    likesOrder,
 			RepliesOrder:  repliesOrder,
 			DislikesOrder: dislikesOrder,
+			Tags:          strings.Join(tagNames, ","),
+			TagMode:       tagMode,
 		},
 	}
 
 	tmpl, err := template.New("post.html").Funcs(template.FuncMap{
-		"add": add,
-		"sub": sub,
+		"profileURL": mention.ProfileURL,
+		"add":        add,
+		"sub":        sub,
 	}).ParseFiles("static/html/post.html")
 	if err != nil {
 		http.Error(w, "Template parsing error", http.StatusInternalServerError)
@@ -764,14 +1113,6 @@ func FilterPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func savePostImageToDB(postImage PostImage) error {
-	_, err := database.DB.Exec(`
-        INSERT INTO PostImage (ID, PostID, UserID, ImagePath, CreatedAt)
-        VALUES (?, ?, ?, ?, ?)`,
-		postImage.ID, postImage.PostID, postImage.UserID, postImage.ImagePath, postImage.CreatedAt)
-	return err
-}
-
 // DeletePostHandler handles requests to delete a post
 func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if the user is authenticated from the context
@@ -816,17 +1157,25 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // deletePost deletes a post from the database
-func deletePost(userID int, postID string) error {
+func deletePost(userID int, postID string) (err error) {
 	tx, err := database.DB.Begin()
 	if err != nil {
 		log.Printf("Failed to begin transaction: %v", err)
 		return err
 	}
+	files := imageFiles(postID)
+	authors := threadAuthors(postID)
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-		} else {
-			tx.Commit()
+		} else if err = tx.Commit(); err == nil {
+			upload.RemoveUnused(files)
+			// Votes on the thread no longer count towards reputation
+			for _, authorID := range authors {
+				if err := reputation.Update(authorID); err != nil {
+					log.Printf("Error updating reputation of user %d: %v", authorID, err)
+				}
+			}
 		}
 	}()
 
@@ -874,6 +1223,26 @@ func checkPostOwnership(tx *sql.Tx, userID int, postID string) error {
 	return nil
 }
 
+// threadAuthors returns the IDs of the authors of a post and its replies.
+func threadAuthors(postID string) []int {
+	rows, err := database.DB.Query(`
+        SELECT UserID FROM Post WHERE PostID = ? AND UserID IS NOT NULL
+        UNION
+        SELECT UserID FROM Comment WHERE PostID = ? AND UserID IS NOT NULL`, postID, postID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var authors []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			authors = append(authors, id)
+		}
+	}
+	return authors
+}
+
 // deletePostLikesAndCommentsTx deletes likes and comments associated with the post
 func deletePostLikesAndCommentsTx(tx *sql.Tx, postID string) error {
 	// Delete post likes
@@ -883,6 +1252,74 @@ func deletePostLikesAndCommentsTx(tx *sql.Tx, postID string) error {
 		return err
 	}
 
+	// Delete post tags
+	_, err = tx.Exec("DELETE FROM PostTag WHERE PostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting post tags for post ID: %s", postID)
+		return err
+	}
+
+	// Delete notifications about the post and its comments
+	_, err = tx.Exec("DELETE FROM Notification WHERE PostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting notifications for post ID: %s", postID)
+		return err
+	}
+
+	// Delete watches on the post
+	_, err = tx.Exec("DELETE FROM PostWatch WHERE PostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting watches for post ID: %s", postID)
+		return err
+	}
+
+	// Delete read markers of the post
+	_, err = tx.Exec("DELETE FROM ReadMarker WHERE PostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting read markers for post ID: %s", postID)
+		return err
+	}
+
+	// Delete mentions in the post and its comments
+	_, err = tx.Exec("DELETE FROM Mention WHERE PostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting mentions for post ID: %s", postID)
+		return err
+	}
+
+	// Delete the image records of the post and its replies, the files are
+	// removed once the post is gone
+	for _, table := range []string{"PostImage", "CommentImage"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE PostID = ?", postID)
+		if err != nil {
+			log.Printf("Error deleting %s rows for post ID: %s", table, postID)
+			return err
+		}
+	}
+
+	// Delete the post's poll with its options, votes and ballots
+	for _, table := range []string{"PollBallot", "PollVote", "PollOption", "Poll"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE PostID = ?", postID)
+		if err != nil {
+			log.Printf("Error deleting %s rows for post ID: %s", table, postID)
+			return err
+		}
+	}
+
+	// Delete reply drafts for the post
+	_, err = tx.Exec("DELETE FROM Draft WHERE PostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting drafts for post ID: %s", postID)
+		return err
+	}
+
+	// Delete redirects of threads that were merged into the post
+	_, err = tx.Exec("DELETE FROM PostRedirect WHERE NewPostID = ?", postID)
+	if err != nil {
+		log.Printf("Error deleting redirects to post ID: %s", postID)
+		return err
+	}
+
 	// Delete post comments (corrected table name)
 	_, err = tx.Exec("DELETE FROM Comment WHERE PostID = ?", postID)
 	if err != nil {
@@ -893,7 +1330,8 @@ func deletePostLikesAndCommentsTx(tx *sql.Tx, postID string) error {
 	return nil
 }
 
-func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
+// MyPostsHandler shows the posts the user has created and the posts they have liked or disliked.
+func MyPostsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	authenticated, ok := ctx.Value(session.Authenticated).(bool)
 	if !ok || !authenticated {
@@ -956,11 +1394,11 @@ func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
 // fetchUserPosts retrieves posts created by the user.
 func fetchUserPosts(userID int) ([]Post, error) {
 	rows, err := database.DB.Query(`
-        SELECT p.PostID, p.Title, p.Content, u.Username
+        SELECT p.PostID, p.Title, p.Content, u.Username, p.PublishAt
         FROM Post p
         JOIN User u ON p.UserID = u.UserID
         WHERE p.UserID = ?
-        ORDER BY p.CreatedAt DESC
+        ORDER BY p.PublishAt IS NULL, p.PublishAt, p.CreatedAt DESC
     `, userID)
 	if err != nil {
 		return nil, err
@@ -970,7 +1408,7 @@ func fetchUserPosts(userID int) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Username)
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Username, &post.PublishAt)
 		if err != nil {
 			return nil, err
 		}
@@ -1013,6 +1451,13 @@ func fetchLikedPosts(userID int) ([]Post, error) {
 // EditPostHandler handles requests to edit a post
 func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
+		authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+		if !authenticated {
+			http.Error(w, "Unauthorized: User not logged in", http.StatusUnauthorized)
+			return
+		}
+		userID, _ := r.Context().Value(session.UserID).(int)
+
 		postID := r.FormValue("postID")
 		content := r.FormValue("content")
 
@@ -1025,8 +1470,54 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// The spoiler settings are only replaced when the edit form sends them
+		_, hasSpoilerFields := r.Form["spoiler_chapter"]
+		book, spoilerChapter, err := parseSpoilerFields(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var authorID sql.NullInt64
+		var scheduled bool
+		err = database.DB.QueryRow(`SELECT UserID, PublishAt IS NOT NULL FROM Post WHERE PostID = ?`, postID).Scan(&authorID, &scheduled)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching post %s: %v", postID, err)
+			http.Error(w, "Error updating post", http.StatusInternalServerError)
+			return
+		}
+
+		// Only the author or a moderator edits a post
+		if !authorID.Valid || int(authorID.Int64) != userID {
+			isModerator, err := database.IsModerator(userID)
+			if err != nil {
+				log.Printf("Error checking moderator role for user %d: %v", userID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !isModerator {
+				log.Printf("User %d is not allowed to edit post %s", userID, postID)
+				http.Error(w, "Forbidden: You can only edit your own posts", http.StatusForbidden)
+				return
+			}
+		}
+		_, hasPublishAt := r.Form["publish_at"]
+		publishAt, err := parsePublishAt(r)
+		if scheduled && hasPublishAt && err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Update the post content in the database
-		result, err := database.DB.Exec(`UPDATE Post SET Content = ? WHERE PostID = ?`, content, postID)
+		result, err := database.DB.Exec(`
+            UPDATE Post SET Content = ?,
+                Book = CASE WHEN ? THEN ? ELSE Book END,
+                SpoilerChapter = CASE WHEN ? THEN ? ELSE SpoilerChapter END
+            WHERE PostID = ?`, content, hasSpoilerFields, book, hasSpoilerFields, spoilerChapter, postID)
 		if err != nil {
 			log.Printf("Error updating post: %v", err)
 			http.Error(w, "Error updating post", http.StatusInternalServerError)
@@ -1046,6 +1537,32 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// A scheduled post can be moved to another time, or published right away
+		// by clearing its publish time. Mentions are only notified once the post
+		// is published.
+		if scheduled {
+			if hasPublishAt {
+				if err := reschedule(postID, publishAt); err != nil {
+					log.Printf("Error rescheduling post %s: %v", postID, err)
+					http.Error(w, "Error updating post", http.StatusInternalServerError)
+					return
+				}
+			}
+		} else {
+			mentioned := recordMentions(postID, "", content)
+			notifyMentions(userID, postID, "", mentioned)
+		}
+
+		// Replace the tags when the edit form sends them
+		if _, ok := r.Form["tags"]; ok {
+			err = tag.SetPostTags(postID, tag.ParseList(r.FormValue("tags")))
+			if err != nil {
+				log.Printf("Error updating tags for postID %s: %v", postID, err)
+				http.Error(w, "Error updating tags", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		log.Printf("Successfully updated postID: %s", postID)
 		http.Redirect(w, r, "/post/view?id="+postID, http.StatusSeeOther)
 	} else {
@@ -1057,6 +1574,19 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 // EditReplyHandler handles requests to edit a reply
 func EditReplyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
+		authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+		if !authenticated {
+			http.Error(w, "Unauthorized: User not logged in", http.StatusUnauthorized)
+			return
+		}
+		userID, _ := r.Context().Value(session.UserID).(int)
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxReplyFormSize)
+		if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+			http.Error(w, "Unable to parse form, the images may be too large", http.StatusBadRequest)
+			return
+		}
+
 		replyID := r.FormValue("replyID")
 		postID := r.FormValue("postID")
 		content := r.FormValue("content")
@@ -1070,8 +1600,47 @@ func EditReplyHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Update the reply in the database
-		result, err := database.DB.Exec(`UPDATE Comment SET Content = ? WHERE CommentID = ?`, content, replyID)
+		// Only the author edits a reply
+		var authorID sql.NullInt64
+		var imageCount int
+		var quotedID string
+		err := database.DB.QueryRow(`
+            SELECT UserID, (SELECT COUNT(*) FROM CommentImage WHERE CommentID = Comment.CommentID), COALESCE(QuotedCommentID, '')
+            FROM Comment WHERE CommentID = ? AND PostID = ?`, replyID, postID).Scan(&authorID, &imageCount, &quotedID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Reply not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching reply %s: %v", replyID, err)
+			http.Error(w, "Error updating reply", http.StatusInternalServerError)
+			return
+		}
+		if !authorID.Valid || int(authorID.Int64) != userID {
+			log.Printf("User %d is not allowed to edit reply %s", userID, replyID)
+			http.Error(w, "Forbidden: You can only edit your own replies", http.StatusForbidden)
+			return
+		}
+
+		// A reply keeps at most maxReplyImages images
+		removeImages := r.Form["remove_image"]
+		var images []*upload.Image
+		if (r.MultipartForm != nil && len(r.MultipartForm.File["images"]) > 0) || len(removeImages) > 0 {
+			images, err = parseImages(r, max(0, maxReplyImages-imageCount+len(removeImages)))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Update the reply in the database, remembering when its text changed
+		// so quotes of it can be flagged as out of date. The reference to a
+		// quoted comment goes once the quote is edited out, as in AddReply
+		keepQuote := quotedID != "" && strings.Contains(content, quoteLink(quotedID))
+		result, err := database.DB.Exec(`
+            UPDATE Comment SET UpdatedAt = CASE WHEN Content != ? THEN ? ELSE UpdatedAt END, Content = ?,
+                QuotedCommentID = CASE WHEN ? THEN QuotedCommentID END
+            WHERE CommentID = ?`, content, time.Now(), content, keepQuote, replyID)
 		if err != nil {
 			log.Printf("Error updating reply: %v", err)
 			http.Error(w, "Error updating reply", http.StatusInternalServerError)
@@ -1091,6 +1660,20 @@ func EditReplyHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := deleteCommentImages(replyID, removeImages); err != nil {
+			log.Printf("Error removing images from reply %s: %v", replyID, err)
+			http.Error(w, "Error updating reply", http.StatusInternalServerError)
+			return
+		}
+		if err := saveCommentImages(replyID, postID, userID, images); err != nil {
+			log.Printf("Error saving images for reply %s: %v", replyID, err)
+			http.Error(w, "Unable to save the images", http.StatusInternalServerError)
+			return
+		}
+
+		mentioned := recordMentions(postID, replyID, content)
+		notifyMentions(userID, postID, replyID, mentioned)
+
 		log.Printf("Successfully updated replyID: %s", replyID)
 		http.Redirect(w, r, "/post/view?id="+postID, http.StatusSeeOther)
 	} else {
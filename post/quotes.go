@@ -0,0 +1,46 @@
+// quotes.go
+package post
+
+import (
+	"database/sql"
+	"lions/database"
+	"strings"
+)
+
+// quoteLink is how a quote links back to the comment it was taken from. A
+// reply only keeps its reference to the quoted comment while the link is in
+// its text.
+func quoteLink(commentID string) string {
+	return "(#comment-" + commentID + ")"
+}
+
+// quoteText formats content as an attributed Markdown quote of the comment
+// commentID by username, followed by an empty line to write the answer after.
+func quoteText(username, commentID, content string) string {
+	var b strings.Builder
+	b.WriteString("> **[" + username + "]" + quoteLink(commentID) + " wrote:**\n")
+	for _, line := range strings.Split(strings.TrimSpace(strings.ReplaceAll(content, "\r\n", "\n")), "\n") {
+		b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// commentQuote returns the quote to pre-fill the reply form with when quoting
+// the comment commentID of the post postID, or an empty string when the
+// comment isn't part of the post.
+func commentQuote(postID, commentID string) (string, error) {
+	var username, content string
+	err := database.DB.QueryRow(`
+        SELECT COALESCE(u.Username, ''), c.Content
+        FROM Comment c
+        LEFT JOIN User u ON c.UserID = u.UserID
+        WHERE c.CommentID = ? AND c.PostID = ?`, commentID, postID).Scan(&username, &content)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return quoteText(username, commentID, content), nil
+}
@@ -0,0 +1,34 @@
+// readstate.go
+package post
+
+import (
+	"lions/readmark"
+	"lions/session"
+	"log"
+	"net/http"
+)
+
+// addReadState fills in how much of each post the logged in user has read.
+// Nothing is shown to visitors, and failures are logged but leave the list as is.
+func addReadState(r *http.Request, posts []Post) {
+	userID, _ := r.Context().Value(session.UserID).(int)
+	if userID == 0 || len(posts) == 0 {
+		return
+	}
+
+	postIDs := make([]string, len(posts))
+	for i, p := range posts {
+		postIDs[i] = p.ID
+	}
+	states, err := readmark.States(userID, postIDs)
+	if err != nil {
+		log.Printf("Error fetching read state for user %d: %v", userID, err)
+		return
+	}
+	for i := range posts {
+		state := states[posts[i].ID]
+		posts[i].New = state.New
+		posts[i].Unread = state.Unread
+		posts[i].FirstUnread = state.FirstUnread
+	}
+}
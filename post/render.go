@@ -0,0 +1,14 @@
+// render.go
+package post
+
+import (
+	"html/template"
+	"lions/markdown"
+	"lions/mention"
+)
+
+// renderContent turns the Markdown of a post or reply into sanitised HTML with
+// @mentions linked to the mentioned users.
+func renderContent(source string) template.HTML {
+	return template.HTML(mention.Linkify(markdown.Render(source)))
+}
@@ -0,0 +1,108 @@
+// replies.go
+package post
+
+import (
+	"database/sql"
+	"lions/database"
+	"lions/env"
+	"sort"
+)
+
+// MaxReplyDepth is the deepest nesting level shown in a reply thread. Replies
+// to a comment at this depth are shown next to it instead of below it. It can
+// be changed with the REPLY_MAX_DEPTH environment variable.
+var MaxReplyDepth = env.Int("REPLY_MAX_DEPTH", 4)
+
+// Reply orderings offered on the post view page.
+var replyOrders = map[string]bool{"oldest": true, "newest": true, "top": true}
+
+// defaultReplyOrder is used when no valid ordering is requested.
+const defaultReplyOrder = "oldest"
+
+// replyView bundles a reply with the page it is rendered on, so the recursive
+// reply template can reach page-wide data such as the logged in user.
+type replyView struct {
+	Page  *PostViewData
+	Reply *FormattedReply
+}
+
+// buildReplyTree arranges the replies of a post into threads. Top-level
+// replies and the children of every reply are sorted by the given order.
+// Replies nested deeper than MaxReplyDepth are attached to their nearest
+// ancestor that still fits.
+func buildReplyTree(replies []*FormattedReply, order string) []*FormattedReply {
+	byID := make(map[string]*FormattedReply, len(replies))
+	for _, reply := range replies {
+		byID[reply.Reply.ID] = reply
+	}
+
+	var roots []*FormattedReply
+	for _, reply := range replies {
+		parent, ok := byID[reply.ParentID]
+		if !ok {
+			roots = append(roots, reply)
+			continue
+		}
+		reply.ParentUsername = parent.Reply.Username
+		parent.Children = append(parent.Children, reply)
+	}
+
+	sortReplies(roots, order)
+	var flatten func(list []*FormattedReply, depth int) []*FormattedReply
+	flatten = func(list []*FormattedReply, depth int) []*FormattedReply {
+		for _, reply := range list {
+			reply.Depth = depth
+			sortReplies(reply.Children, order)
+			if depth == MaxReplyDepth {
+				// Too deep to nest further; lift the descendants up to this level
+				reply.Children = flatten(reply.Children, depth)
+				continue
+			}
+			reply.Children = flatten(reply.Children, depth+1)
+		}
+		if depth < MaxReplyDepth {
+			return list
+		}
+
+		// At the maximum depth every descendant becomes a sibling
+		var flat []*FormattedReply
+		for _, reply := range list {
+			children := reply.Children
+			reply.Children = nil
+			flat = append(flat, reply)
+			flat = append(flat, children...)
+		}
+		return flat
+	}
+	return flatten(roots, 0)
+}
+
+// sortReplies sorts sibling replies oldest first, newest first or by score.
+func sortReplies(replies []*FormattedReply, order string) {
+	sort.SliceStable(replies, func(i, j int) bool {
+		a, b := replies[i], replies[j]
+		switch order {
+		case "newest":
+			return a.Reply.CreatedAt.After(b.Reply.CreatedAt)
+		case "top":
+			scoreA, scoreB := a.LikesCount-a.DislikesCount, b.LikesCount-b.DislikesCount
+			if scoreA != scoreB {
+				return scoreA > scoreB
+			}
+		}
+		return a.Reply.CreatedAt.Before(b.Reply.CreatedAt)
+	})
+}
+
+// validParent reports whether the comment with the given ID belongs to the post.
+func validParent(postID, parentID string) (bool, error) {
+	var commentPostID string
+	err := database.DB.QueryRow(`SELECT PostID FROM Comment WHERE CommentID = ?`, parentID).Scan(&commentPostID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return commentPostID == postID, nil
+}
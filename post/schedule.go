@@ -0,0 +1,118 @@
+// schedule.go
+package post
+
+import (
+	"errors"
+	"lions/category"
+	"lions/database"
+	"lions/env"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// publishAtLayout is the format of datetime-local form inputs. Times are read
+// in the server's time zone.
+const publishAtLayout = "2006-01-02T15:04"
+
+// PublishCheckInterval is how often the scheduler looks for posts that are due
+// to be published. It can be changed with the PUBLISH_CHECK_INTERVAL
+// environment variable.
+var PublishCheckInterval = env.PositiveDuration("PUBLISH_CHECK_INTERVAL", time.Minute)
+
+// parsePublishAt reads the time a new post should go live from the
+// publish_at form field. The zero time means right away.
+func parsePublishAt(r *http.Request) (time.Time, error) {
+	value := strings.TrimSpace(r.FormValue("publish_at"))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	publishAt, err := time.ParseInLocation(publishAtLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid publish time")
+	}
+	if !publishAt.After(time.Now()) {
+		return time.Time{}, errors.New("The publish time must be in the future")
+	}
+	return publishAt, nil
+}
+
+// reschedule changes when the scheduled post postID goes live. The zero time
+// publishes it right away.
+func reschedule(postID string, publishAt time.Time) error {
+	now := time.Now()
+	if publishAt.IsZero() {
+		publishAt = now
+	}
+	_, err := database.DB.Exec(`UPDATE Post SET PublishAt = ? WHERE PostID = ? AND PublishAt IS NOT NULL`,
+		publishAt.UTC(), postID)
+	if err != nil {
+		return err
+	}
+	if !publishAt.After(now) {
+		publishDue(now)
+	}
+	return nil
+}
+
+// StartScheduler publishes scheduled posts in the background once their time
+// has come.
+func StartScheduler() {
+	go func() {
+		for {
+			publishDue(time.Now())
+			time.Sleep(PublishCheckInterval)
+		}
+	}()
+	log.Printf("Post scheduler started, checking every %s", PublishCheckInterval)
+}
+
+// publishDue publishes every scheduled post whose publish time has passed,
+// and sends the notifications that were held back until then.
+func publishDue(now time.Time) {
+	rows, err := database.DB.Query(`
+        SELECT PostID, UserID, CategoryID, Content FROM Post
+        WHERE PublishAt IS NOT NULL AND julianday(PublishAt) <= julianday(?)`, now.UTC())
+	if err != nil {
+		log.Printf("Error fetching scheduled posts: %v", err)
+		return
+	}
+	type scheduledPost struct {
+		id, content        string
+		userID, categoryID int
+	}
+	var due []scheduledPost
+	for rows.Next() {
+		var p scheduledPost
+		if err := rows.Scan(&p.id, &p.userID, &p.categoryID, &p.content); err != nil {
+			log.Printf("Error scanning scheduled post: %v", err)
+			continue
+		}
+		due = append(due, p)
+	}
+	rows.Close()
+
+	for _, p := range due {
+		// The post counts as created when it goes live, so it is listed as new
+		result, err := database.DB.Exec(`UPDATE Post SET PublishAt = NULL, CreatedAt = ? WHERE PostID = ? AND PublishAt IS NOT NULL`,
+			now.Format(time.RFC3339), p.id)
+		if err != nil {
+			log.Printf("Error publishing post %s: %v", p.id, err)
+			continue
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		log.Printf("Published scheduled post %s", p.id)
+
+		mentioned := recordMentions(p.id, "", p.content)
+		notifyMentions(p.userID, p.id, "", mentioned)
+		postCategory, err := category.GetByID(p.categoryID)
+		if err != nil {
+			log.Printf("Error fetching category %d of post %s: %v", p.categoryID, p.id, err)
+			continue
+		}
+		notifyNewThread(p.userID, p.id, postCategory, mentioned)
+	}
+}
@@ -0,0 +1,44 @@
+// spoilers.go
+package post
+
+import (
+	"errors"
+	"lions/progress"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseSpoilerFields reads the book a post is about and the last chapter of
+// it the post spoils from the book and spoiler_chapter form fields. A chapter
+// needs a book to go with it.
+func parseSpoilerFields(r *http.Request) (book string, chapter int, err error) {
+	book = strings.Join(strings.Fields(r.FormValue("book")), " ")
+	if value := strings.TrimSpace(r.FormValue("spoiler_chapter")); value != "" {
+		chapter, err = strconv.Atoi(value)
+		if err != nil || chapter < 0 {
+			return "", 0, errors.New("Invalid spoiler chapter")
+		}
+	}
+	if chapter > 0 && book == "" {
+		return "", 0, errors.New("Enter the book the spoilers are from")
+	}
+	return book, chapter, nil
+}
+
+// spoilerGuard works out whether a post's content should be hidden from the
+// user because it spoils chapters of its book they haven't read yet. It also
+// returns the chapter the user has read up to. Authors always see their own
+// posts, and visitors have read nothing.
+func spoilerGuard(p Post, userID int) (hidden bool, readChapter int, err error) {
+	if p.SpoilerChapter == 0 || p.UserID == userID {
+		return false, 0, nil
+	}
+	if userID != 0 {
+		readChapter, err = progress.Chapter(userID, p.Book)
+		if err != nil {
+			return true, 0, err
+		}
+	}
+	return readChapter < p.SpoilerChapter, readChapter, nil
+}
@@ -0,0 +1,98 @@
+// tags.go
+package post
+
+import (
+	"html/template"
+	"lions/database"
+	"lions/mention"
+	"lions/session"
+	"lions/tag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TagPostsData holds data for rendering the posts with a given tag.
+type TagPostsData struct {
+	Authenticated bool
+	Username      string
+	Tag           string
+	Posts         []Post
+	Pagination    Pagination
+}
+
+// TagPostsHandler shows a paginated list of the posts tagged with the tag
+// named in /tag/{name}.
+func TagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	name := tag.Normalize(strings.TrimPrefix(r.URL.Path, "/tag/"))
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	exists, err := tag.Exists(name)
+	if err != nil {
+		http.Error(w, "Could not retrieve tag", http.StatusInternalServerError)
+		log.Printf("Error retrieving tag %q: %v", name, err)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Extract page number from query parameters
+	currentPage, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || currentPage < 1 {
+		currentPage = 1
+	}
+	postsPerPage := 10
+	offset := (currentPage - 1) * postsPerPage
+
+	condition := `p.PostID IN (SELECT pt.PostID FROM PostTag pt JOIN Tag t ON pt.TagID = t.TagID WHERE t.Name = ?)`
+
+	var totalPosts int
+	err = database.DB.QueryRow(`SELECT COUNT(*) FROM Post p WHERE p.PublishAt IS NULL AND `+condition, name).Scan(&totalPosts)
+	if err != nil {
+		http.Error(w, "Could not retrieve total post count", http.StatusInternalServerError)
+		log.Printf("Error retrieving total post count: %v", err)
+		return
+	}
+
+	posts, err := queryPosts(condition, []interface{}{name}, postsPerPage, offset)
+	if err != nil {
+		http.Error(w, "Could not retrieve posts", http.StatusInternalServerError)
+		log.Printf("Error retrieving posts: %v", err)
+		return
+	}
+
+	addReadState(r, posts)
+
+	data := TagPostsData{
+		Authenticated: r.Context().Value(session.Authenticated).(bool),
+		Username:      r.Context().Value(session.Username).(string),
+		Tag:           name,
+		Posts:         posts,
+		Pagination: Pagination{
+			CurrentPage: currentPage,
+			TotalPages:  (totalPosts + postsPerPage - 1) / postsPerPage,
+			PageSize:    postsPerPage,
+		},
+	}
+
+	tmpl, err := template.New("tag_posts.html").Funcs(template.FuncMap{
+		"profileURL": mention.ProfileURL,
+		"add":        add,
+		"sub":        sub,
+	}).ParseFiles("static/html/tag_posts.html")
+	if err != nil {
+		http.Error(w, "Template parsing error", http.StatusInternalServerError)
+		log.Printf("Error details: %v", err)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		log.Printf("Error details: %v", err)
+	}
+}
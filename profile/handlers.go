@@ -0,0 +1,215 @@
+// handlers.go
+package profile
+
+import (
+	"database/sql"
+	"html/template"
+	"lions/category"
+	"lions/mention"
+	"lions/session"
+	"lions/upload"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// recentActivityLimit is how many posts and replies the activity list shows.
+const recentActivityLimit = 10
+
+// PageData holds data for rendering a public profile.
+type PageData struct {
+	Authenticated bool
+	Username      string // Username of the logged in user
+	Profile       *Profile
+	Own           bool                // Whether the logged in user is looking at their own profile
+	Categories    []category.Category // Genres to pick favourites from, on the user's own profile
+	Activity      []Activity
+	Posts         Page
+	Replies       Page
+	MaxBioLength  int
+	MaxGenres     int
+}
+
+// PageHandler shows the public profile of the user named in the path, at
+// /u/{username}. Its posts and replies are paged with the posts and replies
+// query parameters.
+func PageHandler(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimPrefix(r.URL.Path, "/u/")
+	if username == "" || strings.Contains(username, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	p, err := Get(username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching profile of %s: %v", username, err)
+		http.Error(w, "Could not load profile", http.StatusInternalServerError)
+		return
+	}
+
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	currentUsername, _ := r.Context().Value(session.Username).(string)
+	currentUserID, _ := r.Context().Value(session.UserID).(int)
+	data := PageData{
+		Authenticated: authenticated,
+		Username:      currentUsername,
+		Profile:       p,
+		Own:           authenticated && currentUserID == p.UserID,
+		MaxBioLength:  MaxBioLength,
+		MaxGenres:     MaxGenres,
+	}
+
+	data.Activity, err = RecentActivity(p.UserID, recentActivityLimit)
+	if err != nil {
+		log.Printf("Error fetching activity of %s: %v", username, err)
+	}
+	data.Posts, err = Posts(p.UserID, pageParam(r, "posts"))
+	if err != nil {
+		log.Printf("Error fetching posts of %s: %v", username, err)
+	}
+	data.Replies, err = Replies(p.UserID, pageParam(r, "replies"))
+	if err != nil {
+		log.Printf("Error fetching replies of %s: %v", username, err)
+	}
+	if data.Own {
+		data.Categories, err = category.List(false)
+		if err != nil {
+			log.Printf("Error fetching categories: %v", err)
+		}
+	}
+
+	tmpl, err := template.New("user_profile.html").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+	}).ParseFiles("static/html/user_profile.html")
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// EditHandler saves the bio and favourite genres of the logged in user.
+func EditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+	username, _ := r.Context().Value(session.Username).(string)
+
+	bio := strings.TrimSpace(strings.ReplaceAll(r.FormValue("bio"), "\r\n", "\n"))
+	if utf8.RuneCountInString(bio) > MaxBioLength {
+		http.Error(w, "The bio can be at most "+strconv.Itoa(MaxBioLength)+" characters", http.StatusBadRequest)
+		return
+	}
+
+	// Favourite genres are picked from the categories
+	var genres []string
+	seen := map[string]bool{}
+	for _, name := range r.Form["genre"] {
+		c, err := category.GetByName(name)
+		if err != nil || c.Archived || seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		genres = append(genres, c.Name)
+	}
+	if len(genres) > MaxGenres {
+		http.Error(w, "Pick at most "+strconv.Itoa(MaxGenres)+" favourite genres", http.StatusBadRequest)
+		return
+	}
+
+	if err := Update(userID, bio, genres); err != nil {
+		log.Printf("Error updating profile of user %d: %v", userID, err)
+		http.Error(w, "Could not save profile", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, mention.ProfileURL(username), http.StatusSeeOther)
+}
+
+// AvatarHandler replaces the avatar of the logged in user with an uploaded
+// picture, cropped to a square, or removes it when remove is set.
+func AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+	username, _ := r.Context().Value(session.Username).(string)
+
+	r.Body = http.MaxBytesReader(w, r.Body, upload.MaxImageSize+1<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Unable to parse form, the picture may be too large", http.StatusBadRequest)
+		return
+	}
+
+	var avatar *upload.Image
+	if r.FormValue("remove") == "" {
+		file, _, err := r.FormFile("avatar")
+		if err != nil {
+			http.Error(w, "Choose a picture to upload", http.StatusBadRequest)
+			return
+		}
+		avatar, err = upload.Avatar(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Unused files are only removed after the hold is released, so the new
+	// picture can't go away before the profile refers to it
+	var path string
+	release := upload.Hold()
+	if avatar != nil {
+		var err error
+		path, err = upload.SaveAvatar(avatar)
+		if err != nil {
+			release()
+			log.Printf("Error saving avatar of user %d: %v", userID, err)
+			http.Error(w, "Could not save the picture", http.StatusInternalServerError)
+			return
+		}
+	}
+	old, err := SetAvatar(userID, path)
+	release()
+	if err != nil {
+		upload.RemoveUnused([]string{path})
+		log.Printf("Error updating avatar of user %d: %v", userID, err)
+		http.Error(w, "Could not save the picture", http.StatusInternalServerError)
+		return
+	}
+	if old != path {
+		upload.RemoveUnused([]string{old})
+	}
+	http.Redirect(w, r, mention.ProfileURL(username), http.StatusSeeOther)
+}
+
+// pageParam reads a page number from the query, defaulting to 1.
+func pageParam(r *http.Request, name string) int {
+	page, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
@@ -0,0 +1,250 @@
+// profile.go
+package profile
+
+import (
+	"database/sql"
+	"lions/category"
+	"lions/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Limits on what members write about themselves.
+const (
+	MaxBioLength = 1000
+	MaxGenres    = 5
+)
+
+// pageSize is how many posts or replies a profile lists per page.
+const pageSize = 10
+
+// Profile is the public information about a member.
+type Profile struct {
+	UserID      int
+	Username    string
+	Role        string
+	Bio         string
+	Genres      []category.Category // Favourite genres that still exist as categories
+	AvatarPath  string              // Stored path of the avatar, empty for the default one
+	JoinedAt    sql.NullTime
+	NumPosts    int
+	NumComments int
+	NumLikes    int
+	NumDislikes int
+	Reputation  int // Score from the votes on the member's posts and replies
+}
+
+// Activity is a post or reply in a member's recent activity or lists.
+type Activity struct {
+	PostID    int
+	CommentID int // 0 for the post itself
+	Title     string
+	Category  string
+	Replies   int    // Number of replies, for posts
+	CreatedAt string // Formatted creation date
+}
+
+// URL links to the post or reply.
+func (a Activity) URL() string {
+	url := "/post/view?id=" + strconv.Itoa(a.PostID)
+	if a.CommentID != 0 {
+		url += "#comment-" + strconv.Itoa(a.CommentID)
+	}
+	return url
+}
+
+// Page is one page of a member's posts or replies.
+type Page struct {
+	Items   []Activity
+	Number  int  // Page number, from 1
+	HasPrev bool // Whether there are newer items
+	HasNext bool // Whether there are older items
+}
+
+// Get returns the profile of the member with the given username, or
+// sql.ErrNoRows if there is none.
+func Get(username string) (*Profile, error) {
+	p := Profile{}
+	var genres string
+	err := database.DB.QueryRow(`
+        SELECT UserID, Username, Role, Bio, FavouriteGenres, COALESCE(AvatarPath, ''), CreatedAt, Reputation
+        FROM User WHERE Username = ?`, username).Scan(
+		&p.UserID, &p.Username, &p.Role, &p.Bio, &genres, &p.AvatarPath, &p.JoinedAt, &p.Reputation)
+	if err != nil {
+		return nil, err
+	}
+
+	p.NumPosts, p.NumComments, p.NumLikes, p.NumDislikes, err = database.GetUserStats(p.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range splitGenres(genres) {
+		if c, err := category.GetByName(name); err == nil && !c.Archived {
+			p.Genres = append(p.Genres, c)
+		}
+	}
+	return &p, nil
+}
+
+// GenreNames returns the names of the profile's favourite genres.
+func (p *Profile) GenreNames() map[string]bool {
+	names := map[string]bool{}
+	for _, c := range p.Genres {
+		names[c.Name] = true
+	}
+	return names
+}
+
+// Update saves the bio and favourite genres of a member.
+func Update(userID int, bio string, genres []string) error {
+	_, err := database.DB.Exec(`UPDATE User SET Bio = ?, FavouriteGenres = ? WHERE UserID = ?`,
+		bio, strings.Join(genres, ","), userID)
+	return err
+}
+
+// SetAvatar replaces the avatar of a member and returns the path of the
+// previous one, empty when there was none. An empty path removes the avatar.
+func SetAvatar(userID int, path string) (string, error) {
+	var old sql.NullString
+	err := database.DB.QueryRow(`SELECT AvatarPath FROM User WHERE UserID = ?`, userID).Scan(&old)
+	if err != nil {
+		return "", err
+	}
+	var avatar sql.NullString
+	if path != "" {
+		avatar = sql.NullString{String: path, Valid: true}
+	}
+	_, err = database.DB.Exec(`UPDATE User SET AvatarPath = ? WHERE UserID = ?`, avatar, userID)
+	return old.String, err
+}
+
+// RecentActivity returns the latest posts and replies of a member, newest
+// first. Scheduled posts, and replies in them, are left out.
+func RecentActivity(userID, limit int) ([]Activity, error) {
+	rows, err := database.DB.Query(`
+        SELECT PostID, CommentID, Title, CategoryName, CreatedAt FROM (
+            SELECT p.PostID, 0 AS CommentID, p.Title, c.CategoryName, CAST(p.CreatedAt AS TEXT) AS CreatedAt
+            FROM Post p
+            JOIN Category c ON p.CategoryID = c.CategoryID
+            WHERE p.UserID = ? AND p.PublishAt IS NULL
+            UNION ALL
+            SELECT p.PostID, cm.CommentID, p.Title, c.CategoryName, CAST(cm.CreatedAt AS TEXT)
+            FROM Comment cm
+            JOIN Post p ON cm.PostID = p.PostID
+            JOIN Category c ON p.CategoryID = c.CategoryID
+            WHERE cm.UserID = ? AND p.PublishAt IS NULL
+        )
+        ORDER BY julianday(CreatedAt) DESC
+        LIMIT ?`, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []Activity
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.PostID, &a.CommentID, &a.Title, &a.Category, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.CreatedAt = formatTime(a.CreatedAt)
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// Posts returns a page of the published posts of a member, newest first.
+func Posts(userID, page int) (Page, error) {
+	rows, err := database.DB.Query(`
+        SELECT p.PostID, p.Title, c.CategoryName, CAST(p.CreatedAt AS TEXT),
+               (SELECT COUNT(*) FROM Comment WHERE PostID = p.PostID)
+        FROM Post p
+        JOIN Category c ON p.CategoryID = c.CategoryID
+        WHERE p.UserID = ? AND p.PublishAt IS NULL
+        ORDER BY julianday(p.CreatedAt) DESC
+        LIMIT ? OFFSET ?`, userID, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	var items []Activity
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.PostID, &a.Title, &a.Category, &a.CreatedAt, &a.Replies); err != nil {
+			return Page{}, err
+		}
+		a.CreatedAt = formatTime(a.CreatedAt)
+		items = append(items, a)
+	}
+	return newPage(items, page), rows.Err()
+}
+
+// Replies returns a page of the replies of a member in published threads,
+// newest first.
+func Replies(userID, page int) (Page, error) {
+	rows, err := database.DB.Query(`
+        SELECT p.PostID, cm.CommentID, p.Title, c.CategoryName, CAST(cm.CreatedAt AS TEXT)
+        FROM Comment cm
+        JOIN Post p ON cm.PostID = p.PostID
+        JOIN Category c ON p.CategoryID = c.CategoryID
+        WHERE cm.UserID = ? AND p.PublishAt IS NULL
+        ORDER BY julianday(cm.CreatedAt) DESC
+        LIMIT ? OFFSET ?`, userID, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	var items []Activity
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.PostID, &a.CommentID, &a.Title, &a.Category, &a.CreatedAt); err != nil {
+			return Page{}, err
+		}
+		a.CreatedAt = formatTime(a.CreatedAt)
+		items = append(items, a)
+	}
+	return newPage(items, page), rows.Err()
+}
+
+// newPage builds a page from up to pageSize+1 items; the extra one only tells
+// that there is a next page.
+func newPage(items []Activity, number int) Page {
+	page := Page{Number: number, HasPrev: number > 1}
+	if len(items) > pageSize {
+		items = items[:pageSize]
+		page.HasNext = true
+	}
+	page.Items = items
+	return page
+}
+
+// splitGenres splits the stored comma-separated list of genres.
+func splitGenres(value string) []string {
+	var genres []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			genres = append(genres, name)
+		}
+	}
+	return genres
+}
+
+// formatTime formats a timestamp read from the database as text.
+func formatTime(value string) string {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.Format("January 2, 2006, 3:04 PM")
+	}
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("January 2, 2006, 3:04 PM")
+		}
+	}
+	return value
+}
@@ -0,0 +1,49 @@
+// handlers.go
+package progress
+
+import (
+	"lions/session"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Handler records how far the logged in user has read the book in book, up
+// to the chapter in chapter, and goes back to the post in post_id.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	book := strings.TrimSpace(r.FormValue("book"))
+	if book == "" {
+		http.Error(w, "Book is required", http.StatusBadRequest)
+		return
+	}
+	chapter, err := strconv.Atoi(r.FormValue("chapter"))
+	if err != nil || chapter < 0 {
+		http.Error(w, "Invalid chapter", http.StatusBadRequest)
+		return
+	}
+
+	if err := Set(userID, book, chapter); err != nil {
+		log.Printf("Error saving reading progress of user %d: %v", userID, err)
+		http.Error(w, "Could not save reading progress", http.StatusInternalServerError)
+		return
+	}
+
+	target := "/post"
+	if postID := r.FormValue("post_id"); postID != "" {
+		target = "/post/view?id=" + url.QueryEscape(postID)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
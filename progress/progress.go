@@ -0,0 +1,39 @@
+// progress.go
+package progress
+
+import (
+	"database/sql"
+	"lions/database"
+	"strings"
+	"time"
+)
+
+// NormalizeBook turns a book title into the form progress is stored under, so
+// "The  Hobbit" and "the hobbit" count as the same book.
+func NormalizeBook(book string) string {
+	return strings.ToLower(strings.Join(strings.Fields(book), " "))
+}
+
+// Chapter returns the last chapter of book userID has read, 0 when the user
+// hasn't recorded any progress.
+func Chapter(userID int, book string) (int, error) {
+	var chapter int
+	err := database.DB.QueryRow(`SELECT Chapter FROM ReadingProgress WHERE UserID = ? AND Book = ?`,
+		userID, NormalizeBook(book)).Scan(&chapter)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return chapter, err
+}
+
+// Set records that userID has read book up to chapter.
+func Set(userID int, book string, chapter int) error {
+	_, err := database.DB.Exec(`
+        INSERT INTO ReadingProgress (UserID, Book, Chapter, UpdatedAt)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (UserID, Book) DO UPDATE SET
+            Chapter = excluded.Chapter,
+            UpdatedAt = excluded.UpdatedAt`,
+		userID, NormalizeBook(book), chapter, time.Now())
+	return err
+}
@@ -0,0 +1,151 @@
+// ratelimit.go
+package ratelimit
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"lions/env"
+	"lions/session"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rule describes how many write requests a single client may send to a route
+// within a time window.
+type Rule struct {
+	Name               string        // Name of the route, used to keep budgets separate
+	Requests           int           // Requests allowed per window
+	NewAccountRequests int           // Requests allowed per window for accounts younger than NewAccountAge
+	Window             time.Duration // Length of the window
+}
+
+// Per-route budgets for the routes that change forum content, for the
+// anonymous account routes (login, registration and password resets) and for
+// profile picture uploads.
+var (
+	CreatePostRule = Rule{Name: "post", Requests: 5, NewAccountRequests: 2, Window: 10 * time.Minute}
+	ReplyRule      = Rule{Name: "reply", Requests: 20, NewAccountRequests: 5, Window: 10 * time.Minute}
+	LikeRule       = Rule{Name: "like", Requests: 60, NewAccountRequests: 20, Window: time.Minute}
+	AccountRule    = Rule{Name: "account", Requests: 10, NewAccountRequests: 10, Window: 10 * time.Minute}
+	AvatarRule     = Rule{Name: "avatar", Requests: 10, NewAccountRequests: 5, Window: 10 * time.Minute}
+)
+
+// NewAccountAge is the age below which an account gets the stricter
+// NewAccountRequests budget. It can be changed with the
+// RATE_LIMIT_NEW_ACCOUNT_AGE environment variable (e.g. "48h"); 0 gives new
+// accounts the normal budget.
+var NewAccountAge = env.Duration("RATE_LIMIT_NEW_ACCOUNT_AGE", 72*time.Hour)
+
+// window counts the requests a client has made since the window started.
+type window struct {
+	start  time.Time
+	length time.Duration
+	count  int
+}
+
+// windowStore holds the current window of every client in memory.
+var windowStore = struct {
+	sync.Mutex
+	m         map[string]*window
+	lastSweep time.Time
+}{m: make(map[string]*window)}
+
+// Limit is an HTTP middleware that rejects write requests exceeding the rule's
+// budget with 429 Too Many Requests. Clients are identified by the session's
+// user ID, or by IP address when not logged in. It must be wrapped by
+// session.SessionMiddleware so the session data is in the request context.
+func Limit(rule Rule, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only requests that change data count against the budget
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, budget := clientBudget(r, rule)
+		allowed, retryAfter := take(rule.Name+":"+key, budget, rule.Window)
+		if !allowed {
+			log.Printf("Rate limit exceeded for %s on %s", key, rule.Name)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+0.999)))
+			http.Error(w, "Too many requests, please slow down", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientBudget returns the key identifying the client and the number of
+// requests it may make per window.
+func clientBudget(r *http.Request, rule Rule) (string, int) {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	userID, _ := r.Context().Value(session.UserID).(int)
+	if !authenticated || userID == 0 {
+		return "ip:" + clientIP(r), rule.Requests
+	}
+
+	key := fmt.Sprintf("user:%d", userID)
+	if isNewAccount(userID) {
+		return key, rule.NewAccountRequests
+	}
+	return key, rule.Requests
+}
+
+// take records a request for key and reports whether it fits in the budget.
+// When it does not, it also returns how long until the window resets.
+func take(key string, budget int, length time.Duration) (bool, time.Duration) {
+	now := time.Now()
+
+	windowStore.Lock()
+	defer windowStore.Unlock()
+
+	// Drop expired windows now and then so the map doesn't grow forever
+	if now.Sub(windowStore.lastSweep) > time.Minute {
+		for k, win := range windowStore.m {
+			if now.Sub(win.start) >= win.length {
+				delete(windowStore.m, k)
+			}
+		}
+		windowStore.lastSweep = now
+	}
+
+	win, exists := windowStore.m[key]
+	if !exists || now.Sub(win.start) >= length {
+		win = &window{start: now, length: length}
+		windowStore.m[key] = win
+	}
+
+	if win.count >= budget {
+		return false, win.start.Add(length).Sub(now)
+	}
+	win.count++
+	return true, 0
+}
+
+// isNewAccount reports whether the user registered less than NewAccountAge ago.
+// Accounts created before registration dates were recorded count as established.
+func isNewAccount(userID int) bool {
+	var createdAt sql.NullTime
+	err := database.DB.QueryRow(`SELECT CreatedAt FROM User WHERE UserID = ?`, userID).Scan(&createdAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching account age for user %d: %v", userID, err)
+		}
+		return false
+	}
+	return createdAt.Valid && time.Since(createdAt.Time) < NewAccountAge
+}
+
+// clientIP returns the IP address of the client without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
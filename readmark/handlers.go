@@ -0,0 +1,51 @@
+// handlers.go
+package readmark
+
+import (
+	"database/sql"
+	"lions/category"
+	"lions/session"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CategoryHandler marks every post in the category in category_id as read for
+// the logged in user and goes back to the category.
+func CategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	readCategory, err := category.GetByID(categoryID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching category %d: %v", categoryID, err)
+		http.Error(w, "Could not mark category as read", http.StatusInternalServerError)
+		return
+	}
+
+	if err := MarkCategoryRead(userID, categoryID); err != nil {
+		log.Printf("Error marking category %d as read for user %d: %v", categoryID, userID, err)
+		http.Error(w, "Could not mark category as read", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/c/"+url.PathEscape(readCategory.Slug), http.StatusSeeOther)
+}
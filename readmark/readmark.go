@@ -0,0 +1,100 @@
+// readmark.go
+package readmark
+
+import (
+	"lions/database"
+	"strings"
+	"time"
+)
+
+// State is how much of a thread a user has read. Activity from before the user
+// registered counts as read.
+type State struct {
+	New         bool // The user has never opened the thread
+	Unread      int  // Replies by others the user hasn't read
+	FirstUnread int  // ID of the oldest unread reply, 0 when there is none
+	LastRead    int  // ID of the newest reply the user has read, 0 when none
+}
+
+// unreadCondition selects the comments c of post p that are unread for user u,
+// given the user's read marker m (which may be missing).
+const unreadCondition = `
+        c.PostID = p.PostID AND c.UserID != u.UserID AND
+        CASE WHEN m.LastReadCommentID IS NOT NULL THEN c.CommentID > m.LastReadCommentID
+             ELSE julianday(c.CreatedAt) > julianday(COALESCE(u.CreatedAt, 0)) END`
+
+// States returns the read state of each of the given posts for userID, keyed
+// by post ID. Posts that don't exist are left out.
+func States(userID int, postIDs []string) (map[string]State, error) {
+	states := map[string]State{}
+	if len(postIDs) == 0 {
+		return states, nil
+	}
+
+	args := []interface{}{userID}
+	placeholders := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT p.PostID,
+               m.LastReadCommentID IS NULL AND julianday(p.CreatedAt) > julianday(COALESCE(u.CreatedAt, 0)) AS New,
+               (SELECT COUNT(*) FROM Comment c WHERE `+unreadCondition+`) AS Unread,
+               (SELECT COALESCE(MIN(c.CommentID), 0) FROM Comment c WHERE `+unreadCondition+`) AS FirstUnread,
+               COALESCE(m.LastReadCommentID, 0)
+        FROM Post p
+        JOIN User u ON u.UserID = ?
+        LEFT JOIN ReadMarker m ON m.PostID = p.PostID AND m.UserID = u.UserID
+        WHERE p.PostID IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID string
+		var state State
+		if err := rows.Scan(&postID, &state.New, &state.Unread, &state.FirstUnread, &state.LastRead); err != nil {
+			return nil, err
+		}
+		states[postID] = state
+	}
+	return states, rows.Err()
+}
+
+// Get returns the read state of a single post for userID.
+func Get(userID int, postID string) (State, error) {
+	states, err := States(userID, []string{postID})
+	if err != nil {
+		return State{}, err
+	}
+	return states[postID], nil
+}
+
+// MarkRead records that userID has read a post up to its newest reply.
+func MarkRead(userID int, postID string) error {
+	_, err := database.DB.Exec(`
+        INSERT INTO ReadMarker (UserID, PostID, LastReadCommentID, ReadAt)
+        VALUES (?, ?, (SELECT COALESCE(MAX(CommentID), 0) FROM Comment WHERE PostID = ?), ?)
+        ON CONFLICT (UserID, PostID) DO UPDATE SET
+            LastReadCommentID = MAX(LastReadCommentID, excluded.LastReadCommentID),
+            ReadAt = excluded.ReadAt`,
+		userID, postID, postID, time.Now())
+	return err
+}
+
+// MarkCategoryRead records that userID has read every post in a category.
+func MarkCategoryRead(userID, categoryID int) error {
+	_, err := database.DB.Exec(`
+        INSERT INTO ReadMarker (UserID, PostID, LastReadCommentID, ReadAt)
+        SELECT ?, p.PostID, (SELECT COALESCE(MAX(CommentID), 0) FROM Comment WHERE PostID = p.PostID), ?
+        FROM Post p
+        WHERE p.CategoryID = ? AND p.PublishAt IS NULL
+        ON CONFLICT (UserID, PostID) DO UPDATE SET
+            LastReadCommentID = MAX(LastReadCommentID, excluded.LastReadCommentID),
+            ReadAt = excluded.ReadAt`,
+		userID, time.Now(), categoryID)
+	return err
+}
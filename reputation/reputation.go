@@ -0,0 +1,164 @@
+// reputation.go
+package reputation
+
+import (
+	"database/sql"
+	"fmt"
+	"lions/database"
+	"lions/env"
+	"log"
+	"math"
+	"time"
+)
+
+// Points a vote on a member's post or reply is worth. They can be changed
+// with the REPUTATION_POST_LIKE, REPUTATION_POST_DISLIKE,
+// REPUTATION_COMMENT_LIKE and REPUTATION_COMMENT_DISLIKE environment
+// variables.
+var (
+	PostLikeWeight       = env.Float("REPUTATION_POST_LIKE", 5)
+	PostDislikeWeight    = env.Float("REPUTATION_POST_DISLIKE", -2)
+	CommentLikeWeight    = env.Float("REPUTATION_COMMENT_LIKE", 2)
+	CommentDislikeWeight = env.Float("REPUTATION_COMMENT_DISLIKE", -1)
+)
+
+// HalfLife is the age at which a vote counts half as much as a new one, so
+// reputation reflects recent contributions more than old ones. It can be
+// changed with the REPUTATION_HALF_LIFE environment variable; 0 turns decay
+// off.
+var HalfLife = env.Duration("REPUTATION_HALF_LIFE", 365*24*time.Hour)
+
+// RecomputeInterval is how often every score is recomputed, which keeps them
+// decaying and catches votes on deleted posts. It can be changed with the
+// REPUTATION_RECOMPUTE_INTERVAL environment variable; 0 turns the
+// background recomputation off.
+var RecomputeInterval = env.Duration("REPUTATION_RECOMPUTE_INTERVAL", 24*time.Hour)
+
+// votesQuery selects the author, kind, direction and age in days of every
+// vote on a post or reply. Votes on one's own writing don't count, and votes
+// cast before their time was recorded date from the post or reply itself.
+const votesQuery = `
+    SELECT p.UserID, 0, l.IsLike, julianday(?) - julianday(COALESCE(l.CreatedAt, p.CreatedAt))
+    FROM PostLikes l
+    JOIN Post p ON l.PostID = p.PostID
+    WHERE l.UserID != p.UserID %s
+    UNION ALL
+    SELECT c.UserID, 1, l.IsLike, julianday(?) - julianday(COALESCE(l.CreatedAt, c.CreatedAt))
+    FROM CommentLikes l
+    JOIN Comment c ON l.CommentID = c.CommentID
+    WHERE l.UserID != c.UserID %s`
+
+// Start recomputes every member's reputation in the background every
+// RecomputeInterval.
+func Start() {
+	if RecomputeInterval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			if err := RecomputeAll(time.Now()); err != nil {
+				log.Printf("Error recomputing reputation: %v", err)
+			}
+			time.Sleep(RecomputeInterval)
+		}
+	}()
+	log.Printf("Reputation scheduler started, recomputing every %s", RecomputeInterval)
+}
+
+// Update recomputes the reputation of one member, after one of their posts or
+// replies has been voted on.
+func Update(userID int) error {
+	now := time.Now().UTC()
+	rows, err := database.DB.Query(fmt.Sprintf(votesQuery, "AND p.UserID = ?", "AND c.UserID = ?"),
+		now, userID, now, userID)
+	if err != nil {
+		return err
+	}
+	scores, err := sum(rows)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec(`UPDATE User SET Reputation = ? WHERE UserID = ?`, scores[userID], userID)
+	return err
+}
+
+// RecomputeAll computes the reputation of every member from scratch, with
+// votes decayed to the given time.
+func RecomputeAll(now time.Time) error {
+	now = now.UTC()
+	rows, err := database.DB.Query(fmt.Sprintf(votesQuery, "", ""), now, now)
+	if err != nil {
+		return err
+	}
+	scores, err := sum(rows)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Members without any counted votes go back to zero
+	if _, err := tx.Exec(`UPDATE User SET Reputation = 0`); err != nil {
+		return err
+	}
+	for userID, score := range scores {
+		if _, err := tx.Exec(`UPDATE User SET Reputation = ? WHERE UserID = ?`, score, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sum adds up the weighted and decayed votes read by votesQuery per author.
+func sum(rows *sql.Rows) (map[int]int, error) {
+	defer rows.Close()
+	totals := map[int]float64{}
+	for rows.Next() {
+		var authorID sql.NullInt64
+		var onComment, isLike bool
+		var ageDays sql.NullFloat64
+		if err := rows.Scan(&authorID, &onComment, &isLike, &ageDays); err != nil {
+			return nil, err
+		}
+		if !authorID.Valid {
+			continue
+		}
+		totals[int(authorID.Int64)] += weight(onComment, isLike) * decay(ageDays.Float64)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	scores := make(map[int]int, len(totals))
+	for userID, total := range totals {
+		scores[userID] = int(math.Round(total))
+	}
+	return scores, nil
+}
+
+// weight returns the points a vote is worth before decay.
+func weight(onComment, isLike bool) float64 {
+	switch {
+	case onComment && isLike:
+		return CommentLikeWeight
+	case onComment:
+		return CommentDislikeWeight
+	case isLike:
+		return PostLikeWeight
+	default:
+		return PostDislikeWeight
+	}
+}
+
+// decay returns the share of its weight a vote ageDays old still counts for.
+func decay(ageDays float64) float64 {
+	if HalfLife <= 0 || ageDays <= 0 {
+		return 1
+	}
+	halfLifeDays := HalfLife.Hours() / 24
+	return math.Pow(0.5, ageDays/halfLifeDays)
+}
@@ -0,0 +1,433 @@
+// search.go
+package search
+
+import (
+	"html"
+	"html/template"
+	"lions/category"
+	"lions/database"
+	"lions/mention"
+	"lions/post"
+	"lions/session"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Markers wrapped around matched terms in snippets. They are replaced with
+// <mark> tags only after the snippet has been HTML-escaped.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// resultsPerPage is the number of search results shown per page.
+const resultsPerPage = 10
+
+// ftsEnabled is false when SQLite was built without FTS5, in which case
+// searches fall back to simple LIKE matching.
+var ftsEnabled bool
+
+// schema creates the FTS5 indexes for posts and comments and the triggers that
+// keep them in sync with the Post and Comment tables.
+const schema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS PostSearch USING fts5(
+    Title, Content, content='Post', content_rowid='PostID', tokenize='unicode61 remove_diacritics 2'
+);
+CREATE TRIGGER IF NOT EXISTS post_search_insert AFTER INSERT ON Post BEGIN
+    INSERT INTO PostSearch(rowid, Title, Content) VALUES (new.PostID, new.Title, new.Content);
+END;
+CREATE TRIGGER IF NOT EXISTS post_search_delete AFTER DELETE ON Post BEGIN
+    INSERT INTO PostSearch(PostSearch, rowid, Title, Content) VALUES ('delete', old.PostID, old.Title, old.Content);
+END;
+CREATE TRIGGER IF NOT EXISTS post_search_update AFTER UPDATE OF Title, Content ON Post BEGIN
+    INSERT INTO PostSearch(PostSearch, rowid, Title, Content) VALUES ('delete', old.PostID, old.Title, old.Content);
+    INSERT INTO PostSearch(rowid, Title, Content) VALUES (new.PostID, new.Title, new.Content);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS CommentSearch USING fts5(
+    Content, content='Comment', content_rowid='CommentID', tokenize='unicode61 remove_diacritics 2'
+);
+CREATE TRIGGER IF NOT EXISTS comment_search_insert AFTER INSERT ON Comment BEGIN
+    INSERT INTO CommentSearch(rowid, Content) VALUES (new.CommentID, new.Content);
+END;
+CREATE TRIGGER IF NOT EXISTS comment_search_delete AFTER DELETE ON Comment BEGIN
+    INSERT INTO CommentSearch(CommentSearch, rowid, Content) VALUES ('delete', old.CommentID, old.Content);
+END;
+CREATE TRIGGER IF NOT EXISTS comment_search_update AFTER UPDATE OF Content ON Comment BEGIN
+    INSERT INTO CommentSearch(CommentSearch, rowid, Content) VALUES ('delete', old.CommentID, old.Content);
+    INSERT INTO CommentSearch(rowid, Content) VALUES (new.CommentID, new.Content);
+END;
+`
+
+// Result is a single post or comment matching a search.
+type Result struct {
+	PostID    string
+	CommentID string // Empty when the match is the post itself
+	Title     string
+	Snippet   template.HTML // Excerpt with the matched terms highlighted
+	Username  string
+	Category  string
+	CreatedAt string // Formatted creation date
+}
+
+// Params holds the search query and filters.
+type Params struct {
+	Query    string
+	Author   string
+	Category string
+	From     string // Earliest date, YYYY-MM-DD
+	To       string // Latest date, YYYY-MM-DD
+}
+
+// PageData holds data for rendering the search page.
+type PageData struct {
+	Authenticated bool
+	Username      string
+	Params        Params
+	Results       []Result
+	Total         int
+	Pagination    post.Pagination
+	Categories    []category.Category
+	Searched      bool // Whether a query was given
+}
+
+// triggers lists the triggers created by schema.
+var triggers = []string{
+	"post_search_insert", "post_search_delete", "post_search_update",
+	"comment_search_insert", "comment_search_delete", "comment_search_update",
+}
+
+// Init creates the full-text search indexes. When SQLite lacks FTS5 it logs a
+// warning and searching falls back to LIKE matching.
+func Init() {
+	// The index is missing or stale when the triggers keeping it in sync are
+	// missing, the first time or after a start without FTS5
+	var synced bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'post_search_insert')`).Scan(&synced)
+	if err != nil {
+		log.Fatalf("Failed to check for search index: %v", err)
+	}
+
+	// An index created by an FTS5 build is still there without FTS5, so ask
+	// SQLite rather than waiting for the schema to fail
+	var fts5 bool
+	err = database.DB.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5)
+	if err != nil {
+		log.Fatalf("Failed to check for FTS5: %v", err)
+	}
+	if !fts5 {
+		dropTriggers()
+		log.Println("SQLite was built without FTS5 (build with -tags sqlite_fts5); search falls back to simple matching.")
+		return
+	}
+
+	_, err = database.DB.Exec(schema)
+	if err != nil {
+		log.Fatalf("Failed to create search index: %v", err)
+	}
+	ftsEnabled = true
+
+	// Index the existing posts and comments when the index was not kept in sync
+	if !synced {
+		_, err = database.DB.Exec(`INSERT INTO PostSearch(PostSearch) VALUES('rebuild'); INSERT INTO CommentSearch(CommentSearch) VALUES('rebuild');`)
+		if err != nil {
+			log.Fatalf("Failed to build search index: %v", err)
+		}
+		log.Println("Search index built.")
+	}
+}
+
+// dropTriggers removes the triggers of an index created by an FTS5 build, which
+// would make every new post and comment fail without FTS5. The next start with
+// FTS5 creates them again and rebuilds the index.
+func dropTriggers() {
+	for _, name := range triggers {
+		if _, err := database.DB.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+			log.Fatalf("Failed to drop search trigger %s: %v", name, err)
+		}
+	}
+}
+
+// SearchHandler shows the search form and, when a query is given, one page of
+// matching posts and comments.
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := Params{
+		Query:    strings.TrimSpace(query.Get("q")),
+		Author:   strings.TrimSpace(query.Get("author")),
+		Category: query.Get("category"),
+		From:     validDate(query.Get("from")),
+		To:       validDate(query.Get("to")),
+	}
+
+	currentPage, err := strconv.Atoi(query.Get("page"))
+	if err != nil || currentPage < 1 {
+		currentPage = 1
+	}
+
+	data := PageData{
+		Authenticated: r.Context().Value(session.Authenticated).(bool),
+		Username:      r.Context().Value(session.Username).(string),
+		Params:        params,
+		Searched:      params.Query != "",
+	}
+
+	data.Categories, err = category.List(false)
+	if err != nil {
+		log.Printf("Error retrieving categories: %v", err)
+		http.Error(w, "Could not retrieve categories", http.StatusInternalServerError)
+		return
+	}
+
+	if data.Searched {
+		data.Results, data.Total, err = run(params, resultsPerPage, (currentPage-1)*resultsPerPage)
+		if err != nil {
+			log.Printf("Error searching for %q: %v", params.Query, err)
+			http.Error(w, "Could not search", http.StatusInternalServerError)
+			return
+		}
+	}
+	data.Pagination = post.Pagination{
+		CurrentPage: currentPage,
+		TotalPages:  (data.Total + resultsPerPage - 1) / resultsPerPage,
+		PageSize:    resultsPerPage,
+	}
+
+	tmpl, err := template.New("search.html").Funcs(template.FuncMap{
+		"profileURL": mention.ProfileURL,
+		"add":        func(a, b int) int { return a + b },
+		"sub":        func(a, b int) int { return a - b },
+	}).ParseFiles("static/html/search.html")
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// run searches posts and comments and returns one page of results along with
+// the total number of matches. Results are ranked by bm25, with title matches
+// weighing more than content matches.
+func run(params Params, limit, offset int) ([]Result, int, error) {
+	var postMatch, commentMatch string
+	var postMatchArgs, commentMatchArgs []interface{}
+	if ftsEnabled {
+		postMatch = "PostSearch MATCH ?"
+		commentMatch = "CommentSearch MATCH ?"
+		postMatchArgs = []interface{}{ftsQuery(params.Query)}
+		commentMatchArgs = postMatchArgs
+	} else {
+		postMatch = "(p.Title LIKE ? OR p.Content LIKE ?)"
+		commentMatch = "cm.Content LIKE ?"
+		pattern := "%" + params.Query + "%"
+		postMatchArgs = []interface{}{pattern, pattern}
+		commentMatchArgs = []interface{}{pattern}
+	}
+
+	// Filters shared by both halves of the query
+	var filters []string
+	var filterArgs []interface{}
+	if params.Author != "" {
+		filters = append(filters, "u.Username = ?")
+		filterArgs = append(filterArgs, params.Author)
+	}
+	if params.Category != "" {
+		filters = append(filters, "c.CategoryName = ?")
+		filterArgs = append(filterArgs, params.Category)
+	}
+	if params.From != "" {
+		filters = append(filters, "date(%s.CreatedAt) >= date(?)")
+		filterArgs = append(filterArgs, params.From)
+	}
+	if params.To != "" {
+		filters = append(filters, "date(%s.CreatedAt) <= date(?)")
+		filterArgs = append(filterArgs, params.To)
+	}
+	filterSQL := func(alias string) string {
+		if len(filters) == 0 {
+			return ""
+		}
+		return " AND " + strings.ReplaceAll(strings.Join(filters, " AND "), "%s", alias)
+	}
+
+	postSnippet, commentSnippet := "p.Content", "cm.Content"
+	postRank, commentRank := "0", "0"
+	from, commentFrom := "Post p", "Comment cm"
+	if ftsEnabled {
+		postSnippet = "snippet(PostSearch, -1, char(2), char(3), '…', 24)"
+		commentSnippet = "snippet(CommentSearch, 0, char(2), char(3), '…', 24)"
+		postRank = "bm25(PostSearch, 10.0, 1.0)"
+		commentRank = "bm25(CommentSearch)"
+		from = "PostSearch JOIN Post p ON p.PostID = PostSearch.rowid"
+		commentFrom = "CommentSearch JOIN Comment cm ON cm.CommentID = CommentSearch.rowid"
+	}
+
+	union := `
+        SELECT p.PostID AS PostID, '' AS CommentID, p.Title AS Title, ` + postSnippet + ` AS Snippet,
+               COALESCE(u.Username, '') AS Username, COALESCE(c.CategoryName, '') AS Category,
+               p.CreatedAt AS CreatedAt, ` + postRank + ` AS Rank,
+               p.Book AS Book, p.SpoilerChapter AS SpoilerChapter
+        FROM ` + from + `
+        LEFT JOIN User u ON p.UserID = u.UserID
+        LEFT JOIN Category c ON p.CategoryID = c.CategoryID
+        WHERE ` + postMatch + ` AND p.PublishAt IS NULL` + filterSQL("p") + `
+        UNION ALL
+        SELECT p.PostID, cm.CommentID, p.Title, ` + commentSnippet + `,
+               COALESCE(u.Username, ''), COALESCE(c.CategoryName, ''),
+               cm.CreatedAt, ` + commentRank + `, p.Book, p.SpoilerChapter
+        FROM ` + commentFrom + `
+        JOIN Post p ON cm.PostID = p.PostID
+        LEFT JOIN User u ON cm.UserID = u.UserID
+        LEFT JOIN Category c ON p.CategoryID = c.CategoryID
+        WHERE ` + commentMatch + ` AND p.PublishAt IS NULL` + filterSQL("cm")
+
+	var args []interface{}
+	args = append(args, postMatchArgs...)
+	args = append(args, filterArgs...)
+	args = append(args, commentMatchArgs...)
+	args = append(args, filterArgs...)
+
+	var total int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM (`+union+`)`, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := database.DB.Query(`SELECT PostID, CommentID, Title, Snippet, Username, Category, CreatedAt, Book, SpoilerChapter FROM (`+union+`)
+        ORDER BY Rank, CreatedAt DESC
+        LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var result Result
+		var snippet, createdAt, book string
+		var spoilerChapter int
+		if err := rows.Scan(&result.PostID, &result.CommentID, &result.Title, &snippet, &result.Username, &result.Category, &createdAt, &book, &spoilerChapter); err != nil {
+			return nil, 0, err
+		}
+		if !ftsEnabled {
+			snippet = likeSnippet(snippet, params.Query)
+		}
+		// Threads with chapter spoilers show no text at all, since the
+		// searcher may not have read that far
+		if spoilerChapter > 0 {
+			result.Snippet = template.HTML(html.EscapeString(
+				"Hidden: contains spoilers for " + book + " up to chapter " + strconv.Itoa(spoilerChapter)))
+		} else {
+			result.Snippet = highlight(maskSpoilers(snippet))
+		}
+		result.CreatedAt = formatTime(createdAt)
+		results = append(results, result)
+	}
+
+	return results, total, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query that matches all of its words.
+// Every word is quoted so characters with a meaning in FTS5 syntax match
+// literally, and the last word matches as a prefix.
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// likeSnippet cuts an excerpt around the first occurrence of the query and
+// marks the occurrence, for when FTS5 isn't available.
+func likeSnippet(content, query string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	needle := []rune(strings.ToLower(query))
+
+	index := -1
+	for i := 0; i+len(needle) <= len(lower); i++ {
+		if string(lower[i:i+len(needle)]) == string(needle) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		if len(runes) > 150 {
+			return string(runes[:150]) + "…"
+		}
+		return content
+	}
+
+	start, end := index-60, index+len(needle)+90
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(runes) {
+		end, suffix = len(runes), ""
+	}
+	return prefix + string(runes[start:index]) + markStart + string(runes[index:index+len(needle)]) + markEnd + string(runes[index+len(needle):end]) + suffix
+}
+
+// Spoilers in snippets: complete ones, and the markers left over when the
+// snippet starts or ends inside one.
+var (
+	completeSpoiler = regexp.MustCompile(`(?is)\|\|.*?\|\||\[spoiler\].*?\[/spoiler\]|(^|\n)>!.*`)
+	spoilerStart    = regexp.MustCompile(`(?is)(\|\||\[spoiler\]).*`)
+	spoilerEnd      = regexp.MustCompile(`(?is)^.*\[/spoiler\]`)
+)
+
+// spoilerMask replaces spoiler text in snippets.
+const spoilerMask = "(spoiler)"
+
+// maskSpoilers hides the text of spoilers in a snippet, including spoilers cut
+// off at either end of it.
+func maskSpoilers(snippet string) string {
+	snippet = completeSpoiler.ReplaceAllString(snippet, "$1"+spoilerMask)
+	snippet = spoilerEnd.ReplaceAllString(snippet, spoilerMask)
+	snippet = spoilerStart.ReplaceAllString(snippet, spoilerMask)
+	return snippet
+}
+
+// highlight escapes a snippet and turns the match markers into <mark> tags.
+func highlight(snippet string) template.HTML {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, markStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, markEnd, "</mark>")
+	return template.HTML(escaped)
+}
+
+// formatTime formats a timestamp read from the database as text.
+func formatTime(value string) string {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.Format("January 2, 2006, 3:04 PM")
+	}
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("January 2, 2006, 3:04 PM")
+		}
+	}
+	return value
+}
+
+// validDate returns the date if it is in YYYY-MM-DD form, or an empty string.
+func validDate(value string) string {
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+// drafts.js
+// Autosaves forms marked with data-draft-form as drafts on the server while
+// they are being written, so nothing is lost if the session ends before the
+// form is sent.
+(function () {
+    var fields = ["draft_id", "postID", "title", "content", "category", "tags", "book", "spoiler_chapter"];
+
+    document.querySelectorAll("form[data-draft-form]").forEach(function (form) {
+        var status = form.querySelector("[data-draft-status]");
+        var discard = form.querySelector("[data-draft-discard]");
+        var changed = false;
+        var saving = false;
+        var timer;
+
+        function save() {
+            if (!changed || saving) {
+                return;
+            }
+            changed = false;
+            saving = true;
+
+            var body = new URLSearchParams();
+            fields.forEach(function (name) {
+                var field = form.elements[name];
+                if (field) {
+                    body.append(name, field.value);
+                }
+            });
+
+            fetch("/drafts/save", { method: "POST", body: body, credentials: "same-origin" })
+                .then(function (response) {
+                    if (response.status === 401) {
+                        throw new Error("Your session has ended. Log in again in another tab to keep saving this draft.");
+                    }
+                    if (!response.ok) {
+                        throw new Error("The draft could not be saved.");
+                    }
+                    return response.json();
+                })
+                .then(function (data) {
+                    form.elements.draft_id.value = data.id || "";
+                    discard.hidden = !data.id;
+                    status.textContent = data.id ? "Draft saved at " + new Date().toLocaleTimeString([], { hour: "numeric", minute: "2-digit" }) + "." : "";
+                })
+                .catch(function (error) {
+                    changed = true;
+                    status.textContent = error.message;
+                })
+                .then(function () {
+                    saving = false;
+                });
+        }
+
+        // Save shortly after typing stops, and regularly during long sessions
+        form.addEventListener("input", function () {
+            changed = true;
+            clearTimeout(timer);
+            timer = setTimeout(save, 2000);
+        });
+        form.addEventListener("change", function () {
+            changed = true;
+        });
+        setInterval(save, 30000);
+
+        // Nothing more is saved once the form is sent
+        form.addEventListener("submit", function () {
+            clearTimeout(timer);
+            changed = false;
+        });
+    });
+})();
@@ -0,0 +1,58 @@
+// mentions.js
+// Suggests usernames while typing an @mention in a textarea.
+// Add the data-mention-autocomplete attribute to a textarea to enable it.
+document.querySelectorAll("textarea[data-mention-autocomplete]").forEach(function (textarea) {
+    var list = document.createElement("ul");
+    list.className = "mention-suggestions";
+    list.hidden = true;
+    textarea.after(list);
+
+    // Returns the @mention being typed right before the cursor, if any
+    function currentMention() {
+        var before = textarea.value.slice(0, textarea.selectionStart);
+        var match = before.match(/(^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]*)$/u);
+        return match ? match[2] : null;
+    }
+
+    function insert(username) {
+        var cursor = textarea.selectionStart;
+        var partial = currentMention() || "";
+        var start = cursor - partial.length;
+        textarea.value = textarea.value.slice(0, start) + username + " " + textarea.value.slice(cursor);
+        textarea.selectionStart = textarea.selectionEnd = start + username.length + 1;
+        list.hidden = true;
+        textarea.focus();
+    }
+
+    var timer;
+    textarea.addEventListener("input", function () {
+        clearTimeout(timer);
+        timer = setTimeout(function () {
+            var partial = currentMention();
+            if (!partial) {
+                list.hidden = true;
+                return;
+            }
+
+            fetch("/users/search?q=" + encodeURIComponent(partial))
+                .then(function (response) { return response.json(); })
+                .then(function (users) {
+                    list.innerHTML = "";
+                    users.forEach(function (user) {
+                        var item = document.createElement("li");
+                        item.textContent = "@" + user.username;
+                        item.addEventListener("mousedown", function (event) {
+                            event.preventDefault();
+                            insert(user.username);
+                        });
+                        list.appendChild(item);
+                    });
+                    list.hidden = users.length === 0;
+                });
+        }, 200);
+    });
+
+    textarea.addEventListener("blur", function () {
+        list.hidden = true;
+    });
+});
@@ -0,0 +1,15 @@
+// notifications.js
+// Shows the number of unread notifications on the bell in the page header.
+(function () {
+    var badge = document.querySelector("[data-notification-count]");
+    if (!badge) {
+        return;
+    }
+
+    fetch("/notifications/count")
+        .then(function (response) { return response.json(); })
+        .then(function (data) {
+            badge.textContent = data.unread > 99 ? "99+" : data.unread;
+            badge.hidden = data.unread === 0;
+        });
+})();
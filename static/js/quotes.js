@@ -0,0 +1,49 @@
+// quotes.js
+// Lets the Quote link of a reply quote just the text selected in that reply.
+// Without a selection the link loads the page with the whole reply quoted.
+(function () {
+    var content = document.querySelector("[data-reply-content]");
+    var quoted = document.querySelector("[data-quoted-comment]");
+    if (!content || !quoted) {
+        return;
+    }
+
+    // Clicking the link can clear the selection, so it is read on mousedown
+    var selected = "";
+    document.addEventListener("mousedown", function (event) {
+        var link = event.target.closest(".quote-link");
+        if (!link) {
+            return;
+        }
+        selected = "";
+        var selection = window.getSelection();
+        var reply = document.getElementById("comment-" + link.dataset.quoteId);
+        var text = reply && reply.querySelector(".post-content");
+        if (selection && !selection.isCollapsed && text && text.contains(selection.anchorNode) && text.contains(selection.focusNode)) {
+            selected = selection.toString().trim();
+        }
+    });
+
+    document.addEventListener("click", function (event) {
+        var link = event.target.closest(".quote-link");
+        if (!link || selected === "") {
+            return;
+        }
+        event.preventDefault();
+
+        var id = link.dataset.quoteId;
+        var quote = "> **[" + link.dataset.quoteUsername + "](#comment-" + id + ") wrote:**\n";
+        selected.split(/\r?\n/).forEach(function (line) {
+            quote += ("> " + line).replace(/\s+$/, "") + "\n";
+        });
+        content.value = quote + "\n" + content.value;
+        quoted.value = id;
+        selected = "";
+        // Lets the draft autosave notice the change
+        content.dispatchEvent(new Event("input", { bubbles: true }));
+
+        content.scrollIntoView({ behavior: "smooth", block: "center" });
+        content.focus();
+        content.setSelectionRange(content.value.length, content.value.length);
+    });
+})();
@@ -0,0 +1,20 @@
+// spoilers.js
+// Reveals an inline spoiler when it is clicked, or focused and Enter is pressed.
+(function () {
+    function reveal(event) {
+        var spoiler = event.target.closest(".markdown .spoiler");
+        if (!spoiler || spoiler.tagName === "DETAILS") {
+            return;
+        }
+        if (event.type === "keydown" && event.key !== "Enter" && event.key !== " ") {
+            return;
+        }
+        if (!spoiler.classList.contains("revealed")) {
+            event.preventDefault();
+            spoiler.classList.add("revealed");
+        }
+    }
+
+    document.addEventListener("click", reveal);
+    document.addEventListener("keydown", reveal);
+})();
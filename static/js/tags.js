@@ -0,0 +1,37 @@
+// tags.js
+// Suggests existing tags while typing in comma-separated tag inputs.
+// Add the data-tag-autocomplete attribute to an input to enable it.
+document.querySelectorAll("input[data-tag-autocomplete]").forEach(function (input) {
+    var list = document.createElement("datalist");
+    list.id = input.id + "-suggestions";
+    input.setAttribute("list", list.id);
+    input.setAttribute("autocomplete", "off");
+    input.after(list);
+
+    var timer;
+    input.addEventListener("input", function () {
+        clearTimeout(timer);
+        timer = setTimeout(function () {
+            // Only the tag after the last comma is being typed
+            var parts = input.value.split(",");
+            var current = parts.pop().trim();
+            var before = parts.map(function (p) { return p.trim(); }).filter(Boolean);
+            if (current === "") {
+                list.innerHTML = "";
+                return;
+            }
+
+            fetch("/tags/autocomplete?q=" + encodeURIComponent(current))
+                .then(function (response) { return response.json(); })
+                .then(function (tags) {
+                    list.innerHTML = "";
+                    tags.forEach(function (tag) {
+                        var option = document.createElement("option");
+                        option.value = before.concat(tag.name).join(", ");
+                        option.label = tag.name + " (" + tag.count + ")";
+                        list.appendChild(option);
+                    });
+                });
+        }, 200);
+    });
+});
@@ -0,0 +1,180 @@
+// tag.go
+package tag
+
+import (
+	"database/sql"
+	"encoding/json"
+	"lions/database"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// MaxTagsPerPost limits how many tags a single post can have.
+const MaxTagsPerPost = 10
+
+// maxTagLength limits the length of a single tag name.
+const maxTagLength = 30
+
+// Tag represents a free-form tag and how many posts use it.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Normalize turns user input into a tag name: lower case, with runs of spaces
+// and punctuation replaced by single dashes. It returns an empty string when
+// nothing usable is left.
+func Normalize(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	normalized := strings.TrimSuffix(b.String(), "-")
+	if runes := []rune(normalized); len(runes) > maxTagLength {
+		normalized = strings.TrimSuffix(string(runes[:maxTagLength]), "-")
+	}
+	return normalized
+}
+
+// ParseList splits comma-separated user input into normalized, unique tag
+// names, keeping at most MaxTagsPerPost of them.
+func ParseList(input string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(input, ",") {
+		name := Normalize(part)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		if len(names) == MaxTagsPerPost {
+			break
+		}
+	}
+	return names
+}
+
+// SetPostTags replaces the tags of a post with the given tag names, creating
+// tags that don't exist yet.
+func SetPostTags(postID string, names []string) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = SetPostTagsTx(tx, postID, names)
+	return err
+}
+
+// SetPostTagsTx does what SetPostTags does within tx.
+func SetPostTagsTx(tx *sql.Tx, postID string, names []string) error {
+	_, err := tx.Exec(`DELETE FROM PostTag WHERE PostID = ?`, postID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO Tag (Name) VALUES (?)`, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT OR IGNORE INTO PostTag (PostID, TagID) SELECT ?, TagID FROM Tag WHERE Name = ?`, postID, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForPost returns the tag names of a post in alphabetical order.
+func ForPost(postID string) ([]string, error) {
+	rows, err := database.DB.Query(`
+        SELECT t.Name
+        FROM PostTag pt
+        JOIN Tag t ON pt.TagID = t.TagID
+        WHERE pt.PostID = ?
+        ORDER BY t.Name`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Exists reports whether a tag with the given name exists.
+func Exists(name string) (bool, error) {
+	var id int
+	err := database.DB.QueryRow(`SELECT TagID FROM Tag WHERE Name = ?`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AutocompleteHandler returns, as JSON, up to ten tags starting with the query
+// parameter q, most used first.
+func AutocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := Normalize(r.URL.Query().Get("q"))
+
+	tags := []Tag{}
+	if prefix != "" {
+		// Escape LIKE wildcards so they match literally
+		pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+		rows, err := database.DB.Query(`
+            SELECT t.Name, COUNT(pt.PostID) AS Uses
+            FROM Tag t
+            LEFT JOIN PostTag pt ON t.TagID = pt.TagID
+            WHERE t.Name LIKE ? ESCAPE '\'
+            GROUP BY t.TagID
+            ORDER BY Uses DESC, t.Name
+            LIMIT 10`, pattern)
+		if err != nil {
+			log.Printf("Error searching tags: %v", err)
+			http.Error(w, "Could not search tags", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t Tag
+			if err := rows.Scan(&t.Name, &t.Count); err != nil {
+				log.Printf("Error scanning tag: %v", err)
+				http.Error(w, "Could not search tags", http.StatusInternalServerError)
+				return
+			}
+			tags = append(tags, t)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
@@ -0,0 +1,87 @@
+// access.go
+package upload
+
+import (
+	"lions/database"
+)
+
+// access is who may see a stored file.
+type access int
+
+const (
+	denied   access = iota // No visible post uses the file, or it doesn't exist
+	private                // Only the requester may see it, e.g. an author's scheduled post
+	everyone               // The file belongs to a published post
+)
+
+// inUse reports whether a post image, reply image or avatar refers to the
+// stored file at path.
+func inUse(path string) (bool, error) {
+	var used bool
+	err := database.DB.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM PostImage WHERE ImagePath = ? OR ThumbnailPath = ?)
+            OR EXISTS(SELECT 1 FROM CommentImage WHERE ImagePath = ? OR ThumbnailPath = ?)
+            OR EXISTS(SELECT 1 FROM User WHERE AvatarPath = ?)`, path, path, path, path, path).Scan(&used)
+	return used, err
+}
+
+// accessFor decides whether userID (0 for visitors) may see the stored file
+// at path. Avatars are public. Other files are shown when they belong to a
+// post, or a reply in a post, the user could open: published posts for
+// everyone, scheduled posts only for their author and moderators.
+// Content-addressed files can belong to several posts, and one visible post
+// is enough.
+func accessFor(path string, userID int) (access, error) {
+	// Avatars are shown next to usernames everywhere
+	var avatar bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM User WHERE AvatarPath = ?)`, path).Scan(&avatar)
+	if err != nil {
+		return denied, err
+	}
+	if avatar {
+		return everyone, nil
+	}
+
+	rows, err := database.DB.Query(`
+        SELECT p.UserID, p.PublishAt IS NULL
+        FROM Post p
+        WHERE p.PostID IN (
+            SELECT PostID FROM PostImage WHERE ImagePath = ? OR ThumbnailPath = ?
+            UNION
+            SELECT PostID FROM CommentImage WHERE ImagePath = ? OR ThumbnailPath = ?)`, path, path, path, path)
+	if err != nil {
+		return denied, err
+	}
+	defer rows.Close()
+
+	result := denied
+	scheduled := false
+	for rows.Next() {
+		var authorID int
+		var published bool
+		if err := rows.Scan(&authorID, &published); err != nil {
+			return denied, err
+		}
+		if published {
+			return everyone, nil
+		}
+		if userID != 0 && authorID == userID {
+			result = private
+		}
+		scheduled = true
+	}
+	if err := rows.Err(); err != nil {
+		return denied, err
+	}
+
+	if result == denied && scheduled && userID != 0 {
+		isModerator, err := database.IsModerator(userID)
+		if err != nil {
+			return denied, err
+		}
+		if isModerator {
+			result = private
+		}
+	}
+	return result, nil
+}
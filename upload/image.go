@@ -0,0 +1,241 @@
+// image.go
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Registers the WebP decoder with image.Decode
+)
+
+// Limits on uploaded images.
+const (
+	MaxImages     = 10      // Images per post
+	MaxImageSize  = 5 << 20 // Bytes per image
+	MaxPixels     = 24e6    // Decoded size per image, guards against decompression bombs
+	MaxGIFFrames  = 200     // Frames per animated GIF
+	ThumbnailSize = 320     // Longest side of a thumbnail in pixels
+	jpegQuality   = 90
+)
+
+var (
+	ErrTooLarge        = errors.New("Images can be at most 5 MB")
+	ErrTooManyPixels   = errors.New("The image has too many pixels or animation frames")
+	ErrUnsupportedType = errors.New("Only JPEG, PNG, GIF and WebP images are allowed")
+	ErrInvalidImage    = errors.New("The image could not be read")
+)
+
+// extensions maps the accepted content types, as sniffed from the file
+// contents, to the extension images are stored with.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Image is an uploaded image ready to be stored: metadata has been stripped
+// and a thumbnail generated.
+type Image struct {
+	ContentType   string
+	Data          []byte
+	Thumbnail     []byte
+	ThumbnailType string
+	Width, Height int
+}
+
+// Process reads an uploaded image, checks that it really is a JPEG, PNG, GIF
+// or WebP no matter what the client claims, and re-encodes it so EXIF and
+// other metadata (such as GPS coordinates) are not published.
+func Process(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if _, ok := extensions[contentType]; !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img := &Image{ContentType: contentType}
+	var decoded image.Image
+	switch contentType {
+	case "image/jpeg":
+		decoded, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		// The orientation is kept by rotating the pixels, since the EXIF
+		// block that carried it is dropped
+		decoded = orient(decoded, jpegOrientation(data))
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		img.Data = buf.Bytes()
+	case "image/png":
+		decoded, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, decoded); err != nil {
+			return nil, err
+		}
+		img.Data = buf.Bytes()
+	case "image/gif":
+		// Every frame is decoded, so the limits apply to all of them
+		// together, checked before anything is allocated
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		if frames > MaxGIFFrames || pixels > MaxPixels {
+			return nil, ErrTooManyPixels
+		}
+		// Animated GIFs are re-encoded frame by frame; comments and
+		// application extensions other than looping are dropped
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) == 0 {
+			return nil, ErrInvalidImage
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, err
+		}
+		img.Data = buf.Bytes()
+		decoded = anim.Image[0]
+	case "image/webp":
+		// There is no WebP encoder in the standard library, so the EXIF and
+		// XMP chunks are cut from the file instead of re-encoding it
+		decoded, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		img.Data, err = stripWebPMetadata(data)
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+	}
+
+	bounds := decoded.Bounds()
+	img.Width, img.Height = bounds.Dx(), bounds.Dy()
+	img.Thumbnail, img.ThumbnailType, err = thumbnail(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// Ext returns the file extension the image is stored with.
+func (img *Image) Ext() string {
+	return extensions[img.ContentType]
+}
+
+// thumbnailExt returns the file extension of the thumbnail.
+func (img *Image) thumbnailExt() string {
+	return extensions[img.ThumbnailType]
+}
+
+// thumbnail scales src down to fit in a ThumbnailSize square. Photos are
+// encoded as JPEG, anything that may be transparent as PNG.
+func thumbnail(src image.Image) ([]byte, string, error) {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			w, h = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			w, h = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if opaque(src) {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// opaque reports whether img has no transparent pixels. Only image types
+// that cannot be transparent, or that say they are opaque, count.
+func opaque(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.YCbCrModel, color.CMYKModel, color.GrayModel, color.Gray16Model:
+		return true
+	}
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// AvatarSize is the width and height of avatars in pixels.
+const AvatarSize = 256
+
+// Avatar reads an uploaded picture like Process does, then crops it to a
+// centred square and scales it to AvatarSize. Only the first frame of an
+// animated GIF is kept.
+func Avatar(r io.Reader) (*Image, error) {
+	img, err := Process(r)
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+	size := min(side, AvatarSize)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	var buf bytes.Buffer
+	avatar := &Image{Width: size, Height: size}
+	if opaque(src) {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality})
+		avatar.ContentType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, dst)
+		avatar.ContentType = "image/png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	avatar.Data = buf.Bytes()
+	return avatar, nil
+}
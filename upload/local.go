@@ -0,0 +1,83 @@
+// local.go
+package upload
+
+import (
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage keeps uploads as files in a directory on the server. Files are
+// lost when the directory is not on a persistent volume, for example when a
+// Docker container is recreated.
+type LocalStorage struct {
+	Dir string
+}
+
+// Put writes data to a temporary file first and renames it into place, so a
+// half-written file is never served.
+func (s *LocalStorage) Put(key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrNotFound
+	}
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens the file stored under key. The content type is guessed from the
+// extension, as stored files are named after their sniffed type.
+func (s *LocalStorage) Get(key string) (io.ReadCloser, Info, error) {
+	if !validKey(key) {
+		return nil, Info{}, ErrNotFound
+	}
+	file, err := os.Open(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, err
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		file.Close()
+		return nil, Info{}, ErrNotFound
+	}
+	return file, Info{
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+	}, nil
+}
+
+// Delete removes the file stored under key.
+func (s *LocalStorage) Delete(key string) error {
+	if !validKey(key) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+// metadata.go
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+// jpegOrientation returns the EXIF orientation of a JPEG file, 1 (upright)
+// when it has none.
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA { // Start of scan, no more metadata follows
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return tiffOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation reads the Orientation tag from the first IFD of an EXIF
+// TIFF header.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient turns img upright according to an EXIF orientation value.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored
+				sx, sy = w-1-x, y
+			case 3: // Upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // Mirrored and turned left
+				sx, sy = y, x
+			case 6: // Turned left, needs rotating clockwise
+				sx, sy = y, h-1-x
+			case 7: // Mirrored and turned right
+				sx, sy = w-1-y, h-1-x
+			case 8: // Turned right, needs rotating anticlockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// stripWebPMetadata removes the EXIF and XMP chunks from a WebP file.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a WebP file")
+	}
+	out := append([]byte{}, data[:12]...)
+	for i := 12; i+8 <= len(data); {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2 // Chunks are padded to an even size
+		if size < 0 || i+8+size > len(data) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // Clear the EXIF and XMP flags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// gifFrames walks the blocks of a GIF file without decoding any pixels and
+// returns the number of frames and the pixels they add up to, so oversized
+// animations can be turned away before gif.DecodeAll allocates them.
+func gifFrames(data []byte) (frames, pixels int, err error) {
+	errInvalid := errors.New("invalid GIF")
+	if len(data) < 13 {
+		return 0, 0, errInvalid
+	}
+	i := 13
+	if data[10]&0x80 != 0 { // Global color table
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	// skipSubBlocks moves past a chain of data sub-blocks ended by an empty one
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // Extension: label, then sub-blocks
+			i += 2
+			if !skipSubBlocks() {
+				return 0, 0, errInvalid
+			}
+		case 0x2C: // Image descriptor
+			if i+10 > len(data) {
+				return 0, 0, errInvalid
+			}
+			w := int(binary.LittleEndian.Uint16(data[i+5:]))
+			h := int(binary.LittleEndian.Uint16(data[i+7:]))
+			frames++
+			pixels += w * h
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 { // Local color table
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++ // LZW minimum code size
+			if !skipSubBlocks() {
+				return 0, 0, errInvalid
+			}
+		case 0x3B: // Trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, errInvalid
+		}
+	}
+	return frames, pixels, nil
+}
@@ -0,0 +1,94 @@
+// serve.go
+package upload
+
+import (
+	"io"
+	"lions/session"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler serves stored uploads under /uploads/ from whichever storage is in
+// use. Only files of posts the requester can see are served, and there are
+// no directory listings. Files are named after their contents and never
+// change, so browsers may cache them for good.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+Dir+"/")
+	if !validKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID, _ := r.Context().Value(session.UserID).(int)
+	allowed, err := accessFor(Path(key), userID)
+	if err != nil {
+		log.Printf("Error checking access to upload %s: %v", key, err)
+		http.Error(w, "Could not load the file", http.StatusInternalServerError)
+		return
+	}
+	// Files the user may not see are reported as missing, so their names
+	// can't be probed
+	if allowed == denied {
+		http.NotFound(w, r)
+		return
+	}
+	cacheControl := "public, max-age=31536000, immutable"
+	if allowed == private {
+		cacheControl = "private, no-cache"
+	}
+
+	etag := `"` + key + `"`
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, info, err := Store.Get(key)
+	if err == ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading upload %s: %v", key, err)
+		http.Error(w, "Could not load the file", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if info.ContentType != "" {
+		header.Set("Content-Type", info.ContentType)
+	} else {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+
+	// Local files can seek, which gives range requests and Last-Modified
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, info.ModTime, seeker)
+		return
+	}
+	if !info.ModTime.IsZero() {
+		header.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Error sending upload %s: %v", key, err)
+	}
+}
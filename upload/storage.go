@@ -0,0 +1,69 @@
+// storage.go
+package upload
+
+import (
+	"errors"
+	"io"
+	"lions/env"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by a Storage when no object has the given key.
+var ErrNotFound = errors.New("upload not found")
+
+// Storage keeps uploaded files. Keys are relative names such as
+// "3f5a….jpg"; implementations decide where the bytes actually live.
+type Storage interface {
+	// Put stores data under key, replacing any object already there.
+	Put(key string, data []byte, contentType string) error
+	// Get opens the object stored under key. The caller closes the reader.
+	Get(key string) (io.ReadCloser, Info, error)
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(key string) error
+}
+
+// Info describes a stored object.
+type Info struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// Store is the storage uploads are kept in, chosen by Init.
+var Store Storage = &LocalStorage{Dir: Dir}
+
+// Init picks the upload storage from the environment. UPLOAD_STORAGE=s3 keeps
+// uploads in an S3-compatible bucket, configured with the S3_* variables;
+// anything else keeps them on local disk in UPLOAD_DIR (default "uploads").
+func Init() {
+	switch strings.ToLower(env.String("UPLOAD_STORAGE", "")) {
+	case "s3":
+		s3, err := newS3StorageFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid S3 upload storage settings: %v", err)
+		}
+		Store = s3
+		log.Printf("Storing uploads in S3 bucket %s at %s", s3.Bucket, s3.Endpoint)
+	default:
+		dir := env.String("UPLOAD_DIR", Dir)
+		Store = &LocalStorage{Dir: dir}
+		log.Printf("Storing uploads in %s", dir)
+	}
+}
+
+// validKey reports whether key is a plain object name that cannot escape the
+// storage it is looked up in.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+// store.go
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Dir is the local directory uploads are stored in by default. Stored paths
+// start with it as well, since uploads are served under /uploads/.
+const Dir = "uploads"
+
+// refs keeps RemoveUnused from deleting a file that is being saved again.
+// Files are named after their contents, so a file a deleted post no longer
+// uses can be stored for a new post before the row referring to it exists,
+// which inUse cannot see. Saving holds the read lock until that row is
+// committed and RemoveUnused takes the write lock.
+var refs sync.RWMutex
+
+// Hold is called before storing files with Save or SaveAvatar and returns the
+// function to call once the rows referring to them are committed or given up.
+// RemoveUnused waits for it, so files left over by a failed save are removed
+// after releasing the hold, never while holding it.
+func Hold() (release func()) {
+	refs.RLock()
+	return refs.RUnlock
+}
+
+// Save stores an image and its thumbnail, named after the SHA-256 of their
+// contents; the client's filename is never used. It returns the paths of both
+// files. The same image uploaded twice is stored once. When the thumbnail
+// cannot be stored the image path is still returned, for the caller to remove.
+func Save(img *Image) (imagePath, thumbnailPath string, err error) {
+	imagePath, err = put(img.Data, img.ContentType)
+	if err != nil {
+		return "", "", err
+	}
+	thumbnailPath, err = put(img.Thumbnail, img.ThumbnailType)
+	if err != nil {
+		return imagePath, "", err
+	}
+	return imagePath, thumbnailPath, nil
+}
+
+// put stores data under its content-addressed name and returns its path.
+func put(data []byte, contentType string) (string, error) {
+	key := contentKey(data, extensions[contentType])
+	if err := Store.Put(key, data, contentType); err != nil {
+		return "", err
+	}
+	return Path(key), nil
+}
+
+// contentKey names data after its SHA-256 hash.
+func contentKey(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+// Path returns the stored path of the object key, as saved in the database.
+func Path(key string) string {
+	return Dir + "/" + key
+}
+
+// Key returns the storage key of a stored path.
+func Key(path string) string {
+	return strings.TrimPrefix(path, Dir+"/")
+}
+
+// RemoveUnused deletes the stored files that no post image, reply image or
+// avatar refers to any more. Files are named after their contents, so the
+// same file can be used in several places. It must not be called while
+// holding Hold.
+func RemoveUnused(paths []string) {
+	refs.Lock()
+	defer refs.Unlock()
+
+	var unused []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		used, err := inUse(path)
+		if err != nil {
+			log.Printf("Error checking whether upload %s is in use: %v", path, err)
+			continue
+		}
+		if !used {
+			unused = append(unused, path)
+		}
+	}
+	remove(unused...)
+}
+
+// remove deletes stored files, logging the ones that could not be removed.
+// Content-addressed files can be shared, so only paths that are no longer
+// referenced are passed.
+func remove(paths ...string) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := Store.Delete(Key(path)); err != nil {
+			log.Printf("Error removing upload %s: %v", path, err)
+		}
+	}
+}
+
+// SaveAvatar stores an avatar made by Avatar and returns its path.
+func SaveAvatar(img *Image) (string, error) {
+	return put(img.Data, img.ContentType)
+}
@@ -0,0 +1,70 @@
+package upload
+
+import (
+	"database/sql"
+	"lions/database"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRemoveUnusedWaitsForHold checks that a file stored again for a new post
+// survives a removal that starts before the new post refers to it.
+func TestRemoveUnusedWaitsForHold(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // Every connection to :memory: is a separate database
+	if _, err := db.Exec(`
+        CREATE TABLE PostImage (ImagePath TEXT, ThumbnailPath TEXT);
+        CREATE TABLE CommentImage (ImagePath TEXT, ThumbnailPath TEXT);
+        CREATE TABLE User (AvatarPath TEXT);`); err != nil {
+		t.Fatal(err)
+	}
+	savedDB, savedStore := database.DB, Store
+	database.DB = db
+	dir := t.TempDir()
+	Store = &LocalStorage{Dir: dir}
+	defer func() { database.DB, Store = savedDB, savedStore }()
+
+	release := Hold()
+	path, err := put([]byte("image"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another request deletes a post that used the same file
+	removed := make(chan struct{})
+	go func() {
+		RemoveUnused([]string{path})
+		close(removed)
+	}()
+	select {
+	case <-removed:
+		t.Fatal("RemoveUnused ran while a save was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := db.Exec(`INSERT INTO PostImage (ImagePath) VALUES (?)`, path); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	<-removed
+
+	file := filepath.Join(dir, Key(path))
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("file referred to by the new post was removed: %v", err)
+	}
+
+	// Once nothing refers to it any more, the file goes
+	if _, err := db.Exec(`DELETE FROM PostImage`); err != nil {
+		t.Fatal(err)
+	}
+	RemoveUnused([]string{path})
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("unused file was not removed: %v", err)
+	}
+}
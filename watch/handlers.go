@@ -0,0 +1,171 @@
+// handlers.go
+package watch
+
+import (
+	"database/sql"
+	"html/template"
+	"lions/category"
+	"lions/database"
+	"lions/session"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PageData holds data for rendering the watched threads page.
+type PageData struct {
+	Authenticated bool
+	Username      string
+	Threads       []Thread
+	Categories    []Category
+}
+
+// PageHandler lists the threads and categories the logged in user watches,
+// with how much is new in each since their last visit.
+func PageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	threads, err := Threads(userID)
+	if err != nil {
+		log.Printf("Error fetching watched threads for user %d: %v", userID, err)
+		http.Error(w, "Could not fetch watched threads", http.StatusInternalServerError)
+		return
+	}
+	categories, err := Categories(userID)
+	if err != nil {
+		log.Printf("Error fetching watched categories for user %d: %v", userID, err)
+		http.Error(w, "Could not fetch watched categories", http.StatusInternalServerError)
+		return
+	}
+
+	data := PageData{
+		Authenticated: true,
+		Username:      r.Context().Value(session.Username).(string),
+		Threads:       threads,
+		Categories:    categories,
+	}
+
+	tmpl, err := template.ParseFiles("static/html/watching.html")
+	if err != nil {
+		log.Println("Template parsing error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// PostHandler watches or unwatches the post in post_id, depending on the
+// action field, and goes back to the post.
+func PostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	postID := r.FormValue("post_id")
+	var exists bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM Post WHERE PostID = ?)`, postID).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking post %s: %v", postID, err)
+		http.Error(w, "Could not update watch", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "watch":
+		err = WatchPost(userID, postID)
+	case "unwatch":
+		err = UnwatchPost(userID, postID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating watch on post %s for user %d: %v", postID, userID, err)
+		http.Error(w, "Could not update watch", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectTarget(r, "/post/view?id="+url.QueryEscape(postID)), http.StatusSeeOther)
+}
+
+// CategoryHandler watches or unwatches the category in category_id, depending
+// on the action field, and goes back to the category.
+func CategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	watched, err := category.GetByID(categoryID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching category %d: %v", categoryID, err)
+		http.Error(w, "Could not update watch", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "watch":
+		err = WatchCategory(userID, categoryID)
+	case "unwatch":
+		err = UnwatchCategory(userID, categoryID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating watch on category %d for user %d: %v", categoryID, userID, err)
+		http.Error(w, "Could not update watch", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectTarget(r, "/c/"+url.PathEscape(watched.Slug)), http.StatusSeeOther)
+}
+
+// redirectTarget returns where to go after changing a watch: the /watching
+// page when the form came from there, otherwise the given fallback.
+func redirectTarget(r *http.Request, fallback string) string {
+	if r.FormValue("return") == "watching" {
+		return "/watching"
+	}
+	return fallback
+}
+
+// requireUser redirects to the login page and returns false unless the
+// request comes from a logged in user.
+func requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	authenticated, _ := r.Context().Value(session.Authenticated).(bool)
+	if !authenticated {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, false
+	}
+	userID, _ := r.Context().Value(session.UserID).(int)
+	return userID, true
+}
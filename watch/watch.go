@@ -0,0 +1,175 @@
+// watch.go
+package watch
+
+import (
+	"database/sql"
+	"lions/database"
+	"time"
+)
+
+// Thread is a watched post together with its activity since the user's last visit.
+type Thread struct {
+	PostID        int
+	Title         string
+	Category      string
+	LastReplyUser string
+	LastActivity  time.Time
+	Unread        int // Replies by others since the last visit
+}
+
+// Category is a watched category together with its activity since the user's last visit.
+type Category struct {
+	ID     int
+	Name   string
+	Slug   string
+	Unread int // Threads started by others since the last visit
+}
+
+// WatchPost makes userID watch a post. Watching a post twice is harmless.
+func WatchPost(userID int, postID string) error {
+	now := time.Now()
+	_, err := database.DB.Exec(`INSERT OR IGNORE INTO PostWatch (UserID, PostID, LastVisitedAt, CreatedAt) VALUES (?, ?, ?, ?)`,
+		userID, postID, now, now)
+	return err
+}
+
+// UnwatchPost stops userID from watching a post.
+func UnwatchPost(userID int, postID string) error {
+	_, err := database.DB.Exec(`DELETE FROM PostWatch WHERE UserID = ? AND PostID = ?`, userID, postID)
+	return err
+}
+
+// WatchingPost reports whether userID watches a post.
+func WatchingPost(userID int, postID string) (bool, error) {
+	var watching bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM PostWatch WHERE UserID = ? AND PostID = ?)`,
+		userID, postID).Scan(&watching)
+	return watching, err
+}
+
+// VisitPost records that userID opened a post, resetting its unread count.
+// Nothing happens when the user doesn't watch the post.
+func VisitPost(userID int, postID string) error {
+	_, err := database.DB.Exec(`UPDATE PostWatch SET LastVisitedAt = ? WHERE UserID = ? AND PostID = ?`,
+		time.Now(), userID, postID)
+	return err
+}
+
+// PostWatchers returns the IDs of the users watching a post.
+func PostWatchers(postID string) ([]int, error) {
+	return userIDs(`SELECT UserID FROM PostWatch WHERE PostID = ?`, postID)
+}
+
+// WatchCategory makes userID watch a category. Watching a category twice is harmless.
+func WatchCategory(userID, categoryID int) error {
+	now := time.Now()
+	_, err := database.DB.Exec(`INSERT OR IGNORE INTO CategoryWatch (UserID, CategoryID, LastVisitedAt, CreatedAt) VALUES (?, ?, ?, ?)`,
+		userID, categoryID, now, now)
+	return err
+}
+
+// UnwatchCategory stops userID from watching a category.
+func UnwatchCategory(userID, categoryID int) error {
+	_, err := database.DB.Exec(`DELETE FROM CategoryWatch WHERE UserID = ? AND CategoryID = ?`, userID, categoryID)
+	return err
+}
+
+// WatchingCategory reports whether userID watches a category.
+func WatchingCategory(userID, categoryID int) (bool, error) {
+	var watching bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM CategoryWatch WHERE UserID = ? AND CategoryID = ?)`,
+		userID, categoryID).Scan(&watching)
+	return watching, err
+}
+
+// VisitCategory records that userID opened a category, resetting its unread
+// count. Nothing happens when the user doesn't watch the category.
+func VisitCategory(userID, categoryID int) error {
+	_, err := database.DB.Exec(`UPDATE CategoryWatch SET LastVisitedAt = ? WHERE UserID = ? AND CategoryID = ?`,
+		time.Now(), userID, categoryID)
+	return err
+}
+
+// CategoryWatchers returns the IDs of the users watching a category.
+func CategoryWatchers(categoryID int) ([]int, error) {
+	return userIDs(`SELECT UserID FROM CategoryWatch WHERE CategoryID = ?`, categoryID)
+}
+
+// Threads returns the posts userID watches, most recently active first.
+func Threads(userID int) ([]Thread, error) {
+	rows, err := database.DB.Query(`
+        SELECT p.PostID, p.Title, c.CategoryName, COALESCE(p.LastReplyUser, ''),
+               p.CreatedAt, p.LastReplyDate,
+               (SELECT COUNT(*) FROM Comment cm
+                WHERE cm.PostID = p.PostID AND cm.UserID != w.UserID
+                  AND julianday(cm.CreatedAt) > julianday(w.LastVisitedAt)) AS Unread
+        FROM PostWatch w
+        JOIN Post p ON w.PostID = p.PostID
+        JOIN Category c ON p.CategoryID = c.CategoryID
+        WHERE w.UserID = ?
+        ORDER BY julianday(COALESCE(p.LastReplyDate, p.CreatedAt)) DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var threads []Thread
+	for rows.Next() {
+		var t Thread
+		var lastReply sql.NullTime
+		if err := rows.Scan(&t.PostID, &t.Title, &t.Category, &t.LastReplyUser, &t.LastActivity, &lastReply, &t.Unread); err != nil {
+			return nil, err
+		}
+		if lastReply.Valid {
+			t.LastActivity = lastReply.Time
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+// Categories returns the categories userID watches, in the usual category order.
+func Categories(userID int) ([]Category, error) {
+	rows, err := database.DB.Query(`
+        SELECT c.CategoryID, c.CategoryName, c.Slug,
+               (SELECT COUNT(*) FROM Post p
+                WHERE p.CategoryID = c.CategoryID AND p.UserID != w.UserID AND p.PublishAt IS NULL
+                  AND julianday(p.CreatedAt) > julianday(w.LastVisitedAt)) AS Unread
+        FROM CategoryWatch w
+        JOIN Category c ON w.CategoryID = c.CategoryID
+        WHERE w.UserID = ?
+        ORDER BY c.SortOrder, c.CategoryName`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.Unread); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// userIDs runs a query selecting user IDs and collects the results.
+func userIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}